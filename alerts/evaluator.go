@@ -0,0 +1,185 @@
+package alerts
+
+import (
+	"context"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/Stutern-128/backend/store"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	EventThresholdExceeded  = "threshold.exceeded"
+	EventThresholdRecovered = "threshold.recovered"
+	EventCategoryChanged    = "category.changed"
+)
+
+// Payload is the JSON body posted to subscription webhooks.
+type Payload struct {
+	SubscriptionID    int64     `json:"subscriptionId"`
+	Event             string    `json:"event"`
+	Latitude          float64   `json:"latitude"`
+	Longitude         float64   `json:"longitude"`
+	DateTime          time.Time `json:"dateTime"`
+	AqiCode           string    `json:"aqiCode"`
+	AqiValue          int       `json:"aqiValue"`
+	Category          string    `json:"category"`
+	PreviousCategory  string    `json:"previousCategory,omitempty"`
+	DominantPollutant string    `json:"dominantPollutant"`
+}
+
+// Computations are the extra computations subscriptions are evaluated with.
+var Computations = []string{"LOCAL_AQI", "DOMINANT_POLLUTANT_CONCENTRATION"}
+
+// Evaluator checks every subscription against the current conditions on an
+// interval and sends a webhook when a threshold or category is crossed. The
+// new state of a subscription is only saved once its webhook is delivered,
+// so a crossing whose delivery failed is sent again on the next evaluation.
+type Evaluator struct {
+	Provider providers.AirQualityProvider
+	Store    *store.Store
+	Sender   *Sender
+	Interval time.Duration
+
+	mu sync.Mutex
+	// sending holds the subscriptions whose delivery is still being retried
+	sending    map[int64]bool
+	deliveries sync.WaitGroup
+}
+
+// Run evaluates subscriptions until ctx is cancelled, then waits for the
+// deliveries in progress.
+func (e *Evaluator) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+	defer e.deliveries.Wait()
+	for {
+		e.evaluateAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Evaluator) evaluateAll(ctx context.Context) {
+	subscriptions, err := e.Store.Subscriptions(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading subscriptions", "error", err)
+		return
+	}
+	for _, subscription := range subscriptions {
+		if e.isSending(subscription.ID) {
+			continue
+		}
+		// Subscriptions in the same neighbourhood share the cached lookup
+		airQuality, err := e.Provider.CurrentConditions(ctx, providers.Request{
+			Latitude:          subscription.Latitude,
+			Longitude:         subscription.Longitude,
+			ExtraComputations: Computations,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Error evaluating subscription", "subscription", subscription.ID, "error", err)
+			continue
+		}
+		index, ok := SelectIndex(subscription, airQuality.Indexes)
+		if !ok {
+			slog.WarnContext(ctx, "No index to evaluate subscription", "subscription", subscription.ID)
+			continue
+		}
+		breached := Breached(subscription, index)
+		event := ""
+		switch {
+		case subscription.Threshold == 0 && subscription.Category == "":
+			if subscription.LastCategory != "" && subscription.LastCategory != index.Category {
+				event = EventCategoryChanged
+			}
+		case breached && !subscription.Breached:
+			event = EventThresholdExceeded
+		case !breached && subscription.Breached:
+			event = EventThresholdRecovered
+		}
+		if event == "" {
+			e.saveState(ctx, subscription.ID, index.Category, breached)
+			continue
+		}
+		e.startSending(subscription.ID)
+		go func(subscription store.Subscription, payload Payload) {
+			defer e.finishSending(subscription.ID)
+			if e.Sender.Send(subscription, payload) {
+				e.saveState(context.WithoutCancel(ctx), subscription.ID, payload.Category, breached)
+			}
+		}(subscription, Payload{
+			SubscriptionID:    subscription.ID,
+			Event:             event,
+			Latitude:          subscription.Latitude,
+			Longitude:         subscription.Longitude,
+			DateTime:          airQuality.DateTime,
+			AqiCode:           index.Code,
+			AqiValue:          index.Aqi,
+			Category:          index.Category,
+			PreviousCategory:  subscription.LastCategory,
+			DominantPollutant: index.DominantPollutant,
+		})
+	}
+}
+
+func (e *Evaluator) saveState(ctx context.Context, id int64, category string, breached bool) {
+	if err := e.Store.SetSubscriptionState(ctx, id, category, breached); err != nil {
+		slog.ErrorContext(ctx, "Error saving subscription state", "subscription", id, "error", err)
+	}
+}
+
+func (e *Evaluator) isSending(id int64) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.sending[id]
+}
+
+func (e *Evaluator) startSending(id int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.sending == nil {
+		e.sending = make(map[int64]bool)
+	}
+	e.sending[id] = true
+	e.deliveries.Add(1)
+}
+
+func (e *Evaluator) finishSending(id int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.sending, id)
+	e.deliveries.Done()
+}
+
+// SelectIndex returns the index a subscription is evaluated against: the
+// index its category belongs to, or the first index without a category. It
+// reports false when there is none.
+func SelectIndex(subscription store.Subscription, indexes []models.Index) (models.Index, bool) {
+	for _, index := range indexes {
+		if subscription.Category == "" || models.CategorySeverity(index.Code, subscription.Category) >= 0 {
+			return index, true
+		}
+	}
+	return models.Index{}, false
+}
+
+// Breached reports whether an index reading is at or past the subscription's
+// threshold value or category.
+func Breached(subscription store.Subscription, index models.Index) bool {
+	if subscription.Category != "" {
+		threshold := models.CategorySeverity(index.Code, subscription.Category)
+		return threshold >= 0 && index.Severity() >= threshold
+	}
+	if subscription.Threshold == 0 {
+		return false
+	}
+	if index.HigherIsBetter() {
+		return index.Aqi <= subscription.Threshold
+	}
+	return index.Aqi >= subscription.Threshold
+}
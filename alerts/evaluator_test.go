@@ -0,0 +1,171 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/Stutern-128/backend/store"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProvider serves the index set with set as the current conditions.
+type fakeProvider struct {
+	providers.AirQualityProvider
+	mu    sync.Mutex
+	index models.Index
+}
+
+func (p *fakeProvider) set(aqi int, category string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.index = models.Index{Code: "usa_epa", Aqi: aqi, Category: category}
+}
+
+func (p *fakeProvider) CurrentConditions(ctx context.Context, request providers.Request) (*models.AirQuality, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return &models.AirQuality{DateTime: time.Now(), Indexes: []models.Index{p.index}}, nil
+}
+
+func newTestEvaluator(t *testing.T) (*Evaluator, *fakeProvider) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	provider := &fakeProvider{}
+	return &Evaluator{
+		Provider: provider,
+		Store:    s,
+		Sender:   &Sender{MaxAttempts: 1, Timeout: time.Second, AllowPrivate: true},
+	}, provider
+}
+
+func addSubscription(t *testing.T, e *Evaluator, subscription store.Subscription) {
+	subscription.Latitude, subscription.Longitude = 37.42, -122.08
+	subscription.Secret = "secret"
+	if err := e.Store.AddSubscription(context.Background(), &subscription); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// evaluate runs one evaluation and returns the events delivered by it.
+func evaluate(t *testing.T, e *Evaluator, r *receiver) []string {
+	before := len(r.received())
+	e.evaluateAll(context.Background())
+	e.deliveries.Wait()
+	var events []string
+	for _, d := range r.received()[before:] {
+		var payload Payload
+		if err := json.Unmarshal(d.body, &payload); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, payload.Event)
+	}
+	return events
+}
+
+func TestEvaluatorTransitions(t *testing.T) {
+	tests := []struct {
+		name         string
+		subscription store.Subscription
+		readings     []models.Index
+		events       [][]string
+	}{
+		{
+			name:         "threshold",
+			subscription: store.Subscription{Threshold: 100},
+			readings: []models.Index{
+				{Aqi: 40, Category: "Good air quality"},
+				{Aqi: 150, Category: "Unhealthy air quality for sensitive groups"},
+				{Aqi: 160, Category: "Unhealthy air quality"},
+				{Aqi: 60, Category: "Moderate air quality"},
+				{Aqi: 50, Category: "Good air quality"},
+			},
+			events: [][]string{nil, {EventThresholdExceeded}, nil, {EventThresholdRecovered}, nil},
+		},
+		{
+			name:         "category",
+			subscription: store.Subscription{Category: "Unhealthy air quality for sensitive groups"},
+			readings: []models.Index{
+				{Aqi: 80, Category: "Moderate air quality"},
+				{Aqi: 210, Category: "Very unhealthy air quality"},
+				{Aqi: 120, Category: "Unhealthy air quality for sensitive groups"},
+				{Aqi: 30, Category: "Good air quality"},
+			},
+			events: [][]string{nil, {EventThresholdExceeded}, nil, {EventThresholdRecovered}},
+		},
+		{
+			name:         "category change",
+			subscription: store.Subscription{},
+			readings: []models.Index{
+				{Aqi: 30, Category: "Good air quality"},
+				{Aqi: 40, Category: "Good air quality"},
+				{Aqi: 70, Category: "Moderate air quality"},
+				{Aqi: 75, Category: "Moderate air quality"},
+			},
+			events: [][]string{nil, nil, {EventCategoryChanged}, nil},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, provider := newTestEvaluator(t)
+			r, server := newReceiver(t)
+			test.subscription.WebhookURL = server.URL
+			addSubscription(t, e, test.subscription)
+			for i, reading := range test.readings {
+				provider.set(reading.Aqi, reading.Category)
+				events := evaluate(t, e, r)
+				if len(events) != len(test.events[i]) || (len(events) > 0 && events[0] != test.events[i][0]) {
+					t.Errorf("reading %d (%s): events = %v, want %v", i, reading.Category, events, test.events[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluatorResendsFailedDelivery(t *testing.T) {
+	e, provider := newTestEvaluator(t)
+	r, server := newReceiver(t, http.StatusInternalServerError)
+	addSubscription(t, e, store.Subscription{Threshold: 100, WebhookURL: server.URL})
+
+	provider.set(150, "Unhealthy air quality for sensitive groups")
+	if events := evaluate(t, e, r); len(events) != 1 {
+		t.Fatalf("first evaluation delivered %v, want one failed delivery", events)
+	}
+	events := evaluate(t, e, r)
+	if len(events) != 1 || events[0] != EventThresholdExceeded {
+		t.Fatalf("second evaluation delivered %v, want the crossing again", events)
+	}
+	if events := evaluate(t, e, r); len(events) != 0 {
+		t.Errorf("third evaluation delivered %v, want nothing once delivered", events)
+	}
+}
+
+func TestSelectIndex(t *testing.T) {
+	indexes := []models.Index{
+		{Code: "uaqi", Category: "Good air quality"},
+		{Code: "usa_epa", Category: "Moderate air quality"},
+	}
+	tests := []struct {
+		category string
+		code     string
+		ok       bool
+	}{
+		{category: "", code: "uaqi", ok: true},
+		{category: "Low air quality", code: "uaqi", ok: true},
+		{category: "Hazardous air quality", code: "usa_epa", ok: true},
+		{category: "Unknown air quality", ok: false},
+	}
+	for _, test := range tests {
+		index, ok := SelectIndex(store.Subscription{Category: test.category}, indexes)
+		if ok != test.ok || index.Code != test.code {
+			t.Errorf("SelectIndex(%q) = %q, %v, want %q, %v", test.category, index.Code, ok, test.code, test.ok)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package alerts
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/Stutern-128/backend/store"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Zephyr-Signature"
+	TimestampHeader = "X-Zephyr-Timestamp"
+)
+
+// ErrPrivateAddress rejects webhooks that would reach the server's own
+// network rather than a public receiver.
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// Sender posts signed payloads to webhooks, retrying failed deliveries with
+// exponential backoff.
+type Sender struct {
+	MaxAttempts int
+	// Backoff is the delay before the first retry; it doubles on each attempt
+	Backoff time.Duration
+	Timeout time.Duration
+	// AllowPrivate lets webhooks reach loopback, link-local and private
+	// addresses, for receivers on the local network
+	AllowPrivate bool
+}
+
+// Send delivers a payload to the subscription webhook and reports whether it
+// was accepted with a 2xx status.
+func (s *Sender) Send(subscription store.Subscription, payload Payload) bool {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Error encoding webhook payload", "subscription", subscription.ID, "error", err)
+		return false
+	}
+	backoff := s.Backoff
+	for attempt := 1; attempt <= s.MaxAttempts; attempt++ {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		agent := fiber.Post(subscription.WebhookURL)
+		if agent.HostClient != nil && !s.AllowPrivate {
+			// The address is checked once resolved, so that a public name
+			// can't be pointed at a private address after the URL was accepted
+			dialer := &net.Dialer{Timeout: s.Timeout, Control: dialPublic}
+			agent.HostClient.Dial = func(addr string) (net.Conn, error) {
+				return dialer.Dial("tcp", addr)
+			}
+		}
+		agent.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		agent.Set(TimestampHeader, timestamp)
+		agent.Set(SignatureHeader, "sha256="+Sign(subscription.Secret, timestamp, body))
+		agent.Body(body)
+		agent.Timeout(s.Timeout)
+		statusCode, _, errs := agent.Bytes()
+		if len(errs) == 0 && statusCode >= 200 && statusCode < 300 {
+			return true
+		}
+		slog.Warn("Webhook delivery failed", "subscription", subscription.ID,
+			"attempt", attempt, "maxAttempts", s.MaxAttempts, "status", statusCode, "error", errors.Join(errs...))
+		if attempt < s.MaxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return false
+}
+
+// CheckURL reports why rawURL can't be used as a webhook, if it can't: it
+// must be http or https, and must not name a loopback, link-local or private
+// address. Host names are checked again when resolved on delivery.
+func CheckURL(rawURL string) error {
+	webhookURL, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Hostname() == "" {
+		return errors.New("webhook URL must be http or https with a host")
+	}
+	host := strings.ToLower(strings.TrimSuffix(webhookURL.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublic(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// dialPublic refuses connections to addresses that aren't public.
+func dialPublic(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, private like the
+// RFC 1918 ranges.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPublic(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() && !sharedAddressSpace.Contains(ip)
+}
+
+// Sign returns the hex HMAC-SHA256 of "timestamp.body" under secret.
+// Receivers recompute it to verify a payload and reject stale timestamps to
+// prevent replays.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret returns a random signing secret.
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
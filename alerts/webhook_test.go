@@ -0,0 +1,165 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Stutern-128/backend/store"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a local webhook endpoint answering with the queued statuses,
+// then 204, and recording each delivery.
+type receiver struct {
+	mu         sync.Mutex
+	statuses   []int
+	deliveries []delivery
+}
+
+type delivery struct {
+	at        time.Time
+	timestamp string
+	signature string
+	body      []byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, *httptest.Server) {
+	r := &receiver{statuses: statuses}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.deliveries = append(r.deliveries, delivery{
+			at:        time.Now(),
+			timestamp: req.Header.Get(TimestampHeader),
+			signature: req.Header.Get(SignatureHeader),
+			body:      body,
+		})
+		status := http.StatusNoContent
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return r, server
+}
+
+func (r *receiver) received() []delivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]delivery(nil), r.deliveries...)
+}
+
+func TestSendSignsPayload(t *testing.T) {
+	r, server := newReceiver(t)
+	sender := &Sender{MaxAttempts: 1, Timeout: time.Second, AllowPrivate: true}
+	subscription := store.Subscription{ID: 7, WebhookURL: server.URL, Secret: "secret"}
+	payload := Payload{SubscriptionID: 7, Event: EventThresholdExceeded, AqiCode: "uaqi", AqiValue: 30}
+
+	if !sender.Send(subscription, payload) {
+		t.Fatal("Send() = false, want true")
+	}
+	deliveries := r.received()
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(deliveries))
+	}
+	d := deliveries[0]
+	if want := "sha256=" + Sign("secret", d.timestamp, d.body); d.signature != want {
+		t.Errorf("signature = %q, want %q", d.signature, want)
+	}
+	if d.signature == "sha256="+Sign("other", d.timestamp, d.body) {
+		t.Error("signature verifies under another secret")
+	}
+	var received Payload
+	if err := json.Unmarshal(d.body, &received); err != nil {
+		t.Fatal(err)
+	}
+	if received != payload {
+		t.Errorf("payload = %+v, want %+v", received, payload)
+	}
+}
+
+func TestSendRetriesWithBackoff(t *testing.T) {
+	r, server := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+	backoff := 50 * time.Millisecond
+	sender := &Sender{MaxAttempts: 3, Backoff: backoff, Timeout: time.Second, AllowPrivate: true}
+
+	if !sender.Send(store.Subscription{WebhookURL: server.URL}, Payload{}) {
+		t.Fatal("Send() = false, want true")
+	}
+	deliveries := r.received()
+	if len(deliveries) != 3 {
+		t.Fatalf("got %d deliveries, want 3", len(deliveries))
+	}
+	if gap := deliveries[1].at.Sub(deliveries[0].at); gap < backoff {
+		t.Errorf("first retry after %s, want at least %s", gap, backoff)
+	}
+	if gap := deliveries[2].at.Sub(deliveries[1].at); gap < 2*backoff {
+		t.Errorf("second retry after %s, want at least %s", gap, 2*backoff)
+	}
+}
+
+func TestSendGivesUp(t *testing.T) {
+	r, server := newReceiver(t, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	sender := &Sender{MaxAttempts: 2, Backoff: time.Millisecond, Timeout: time.Second, AllowPrivate: true}
+
+	if sender.Send(store.Subscription{WebhookURL: server.URL}, Payload{}) {
+		t.Fatal("Send() = true, want false")
+	}
+	if got := len(r.received()); got != 2 {
+		t.Errorf("got %d deliveries, want 2", got)
+	}
+}
+
+func TestSendRefusesPrivateAddress(t *testing.T) {
+	r, server := newReceiver(t)
+	sender := &Sender{MaxAttempts: 1, Timeout: time.Second}
+
+	if sender.Send(store.Subscription{WebhookURL: server.URL}, Payload{}) {
+		t.Fatal("Send() = true, want false")
+	}
+	if got := len(r.received()); got != 0 {
+		t.Errorf("got %d deliveries, want 0", got)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		private bool
+		invalid bool
+	}{
+		{url: "https://hooks.example.com/aqi"},
+		{url: "http://93.184.216.34:8080/hook"},
+		{url: "ftp://hooks.example.com/aqi", invalid: true},
+		{url: "https:///aqi", invalid: true},
+		{url: "http://localhost:3000/hook", private: true},
+		{url: "http://api.localhost/hook", private: true},
+		{url: "http://127.0.0.1/hook", private: true},
+		{url: "http://[::1]/hook", private: true},
+		{url: "http://169.254.169.254/latest/meta-data", private: true},
+		{url: "http://10.0.0.8/hook", private: true},
+		{url: "http://172.16.4.1/hook", private: true},
+		{url: "http://192.168.1.10/hook", private: true},
+		{url: "http://100.64.0.1/hook", private: true},
+		{url: "http://0.0.0.0/hook", private: true},
+		{url: "http://[fd00::1]/hook", private: true},
+		{url: "http://[::ffff:127.0.0.1]/hook", private: true},
+	}
+	for _, test := range tests {
+		err := CheckURL(test.url)
+		switch {
+		case test.private && !errors.Is(err, ErrPrivateAddress):
+			t.Errorf("CheckURL(%q) = %v, want ErrPrivateAddress", test.url, err)
+		case test.invalid && err == nil:
+			t.Errorf("CheckURL(%q) = nil, want an error", test.url)
+		case !test.private && !test.invalid && err != nil:
+			t.Errorf("CheckURL(%q) = %v, want nil", test.url, err)
+		}
+	}
+}
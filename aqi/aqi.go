@@ -0,0 +1,146 @@
+package aqi
+
+import (
+	"fmt"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/units"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Index codes, matching the Air Quality API codes where Google has the same index.
+const (
+	USEPA    = "usa_epa"
+	EUCAQI   = "eu_caqi"
+	UKDAQI   = "gbr_defra"
+	IndiaAQI = "ind_cpcb"
+	ChinaAQI = "chn_mep"
+)
+
+// Concentration units used by the breakpoint tables.
+const (
+	microgramsPerCubicMeter = units.MicrogramsPerCubicMeter
+	milligramsPerCubicMeter = units.MilligramsPerCubicMeter
+	partsPerBillion         = units.PartsPerBillion
+	partsPerMillion         = units.PartsPerMillion
+)
+
+// SubIndex is the index value a single pollutant maps to.
+type SubIndex struct {
+	Pollutant     string  `json:"pollutant"`
+	Aqi           int     `json:"aqi"`
+	Concentration float64 `json:"concentration"`
+	Units         string  `json:"units"`
+}
+
+// Result is an index computed from raw concentrations. The headline AQI is
+// the highest sub-index and its pollutant is the dominant one.
+type Result struct {
+	Code              string       `json:"code"`
+	DisplayName       string       `json:"displayName"`
+	Aqi               int          `json:"aqi"`
+	Category          string       `json:"category"`
+	Color             models.Color `json:"color"`
+	DominantPollutant string       `json:"dominantPollutant"`
+	SubIndexes        []SubIndex   `json:"subIndexes"`
+}
+
+// Codes returns the codes of every index Compute supports.
+func Codes() []string {
+	codes := make([]string, 0, len(standards))
+	for code := range standards {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Compute returns the index with the given code for concentrations keyed by
+// pollutant code (pm25, pm10, o3, no2, so2, co). The tables are defined for
+// averaging periods of 1 to 24 hours depending on pollutant and index; hourly
+// values are accepted as an approximation. Pollutants an index does not use
+// are skipped.
+func Compute(code string, concentrations map[string]models.Concentration) (Result, error) {
+	standard, ok := standards[code]
+	if !ok {
+		return Result{}, fmt.Errorf("unknown index %q", code)
+	}
+	result := Result{Code: code, DisplayName: standard.displayName, Aqi: -1}
+	for pollutant, concentration := range concentrations {
+		breakpoints, ok := standard.breakpoints[pollutant]
+		if !ok {
+			continue
+		}
+		tableUnits := standard.units[pollutant]
+		value, err := units.Convert(pollutant, concentration.Value, concentration.Units, tableUnits, units.Conditions{})
+		if err != nil {
+			continue
+		}
+		subIndex := SubIndex{
+			Pollutant:     pollutant,
+			Aqi:           interpolate(breakpoints, standard.truncate(pollutant, value), standard.extrapolate),
+			Concentration: value,
+			Units:         tableUnits,
+		}
+		result.SubIndexes = append(result.SubIndexes, subIndex)
+		if subIndex.Aqi > result.Aqi || (subIndex.Aqi == result.Aqi && pollutant < result.DominantPollutant) {
+			result.Aqi, result.DominantPollutant = subIndex.Aqi, pollutant
+		}
+	}
+	if result.Aqi < 0 {
+		return Result{}, fmt.Errorf("no pollutants usable for %s", code)
+	}
+	sort.Slice(result.SubIndexes, func(i, j int) bool {
+		return result.SubIndexes[i].Aqi > result.SubIndexes[j].Aqi
+	})
+	category := standard.categories[len(standard.categories)-1]
+	for _, c := range standard.categories {
+		if result.Aqi <= c.max {
+			category = c
+			break
+		}
+	}
+	result.Category, result.Color = category.name, category.color
+	return result, nil
+}
+
+// Index shapes the result like an index returned by the Air Quality API.
+func (r Result) Index() models.Index {
+	return models.Index{
+		Code:              r.Code,
+		DisplayName:       r.DisplayName,
+		Aqi:               r.Aqi,
+		AqiDisplay:        strconv.Itoa(r.Aqi),
+		Color:             r.Color,
+		Category:          r.Category,
+		DominantPollutant: r.DominantPollutant,
+	}
+}
+
+// interpolate maps a concentration onto the index scale. Values that fall in
+// the gap between two rounded breakpoints take the higher band's low end;
+// values past the table are capped, or extrapolated along the last band.
+func interpolate(breakpoints []breakpoint, value float64, extrapolate bool) int {
+	for _, bp := range breakpoints {
+		if value <= bp.high {
+			if value < bp.low {
+				value = bp.low
+			}
+			return bp.index(value)
+		}
+	}
+	last := breakpoints[len(breakpoints)-1]
+	if extrapolate {
+		return last.index(value)
+	}
+	return last.indexHigh
+}
+
+func (bp breakpoint) index(value float64) int {
+	if bp.high == bp.low {
+		return bp.indexLow
+	}
+	aqi := float64(bp.indexHigh-bp.indexLow)/(bp.high-bp.low)*(value-bp.low) + float64(bp.indexLow)
+	return int(math.Round(aqi))
+}
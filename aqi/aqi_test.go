@@ -0,0 +1,150 @@
+package aqi
+
+import (
+	"github.com/Stutern-128/backend/models"
+	"math"
+	"testing"
+)
+
+func TestComputeBreakpointEdges(t *testing.T) {
+	tests := []struct {
+		code      string
+		pollutant string
+		value     float64
+		units     string
+		aqi       int
+		category  string
+	}{
+		// US EPA, with PM2.5 and CO truncated to one decimal and the rest to integers
+		{USEPA, "pm25", 9.0, microgramsPerCubicMeter, 50, "Good air quality"},
+		{USEPA, "pm25", 9.05, microgramsPerCubicMeter, 50, "Good air quality"},
+		{USEPA, "pm25", 9.1, microgramsPerCubicMeter, 51, "Moderate air quality"},
+		{USEPA, "pm25", 35.4, microgramsPerCubicMeter, 100, "Moderate air quality"},
+		{USEPA, "pm25", 35.5, microgramsPerCubicMeter, 101, "Unhealthy air quality for sensitive groups"},
+		{USEPA, "pm25", 55.5, microgramsPerCubicMeter, 151, "Unhealthy air quality"},
+		{USEPA, "pm25", 125.5, microgramsPerCubicMeter, 201, "Very unhealthy air quality"},
+		{USEPA, "pm25", 225.5, microgramsPerCubicMeter, 301, "Hazardous air quality"},
+		{USEPA, "pm25", 325.4, microgramsPerCubicMeter, 500, "Hazardous air quality"},
+		{USEPA, "pm25", 600, microgramsPerCubicMeter, 500, "Hazardous air quality"},
+		{USEPA, "o3", 54, partsPerBillion, 50, "Good air quality"},
+		{USEPA, "o3", 54.9, partsPerBillion, 50, "Good air quality"},
+		{USEPA, "o3", 55, partsPerBillion, 51, "Moderate air quality"},
+		{USEPA, "o3", 71, partsPerBillion, 101, "Unhealthy air quality for sensitive groups"},
+		{USEPA, "co", 4.4, partsPerMillion, 50, "Good air quality"},
+		{USEPA, "co", 4.5, partsPerMillion, 51, "Moderate air quality"},
+		{USEPA, "no2", 100, partsPerBillion, 100, "Moderate air quality"},
+		{USEPA, "no2", 101, partsPerBillion, 101, "Unhealthy air quality for sensitive groups"},
+
+		// CAQI interpolates without gaps and continues past 100
+		{EUCAQI, "no2", 50, microgramsPerCubicMeter, 25, "Very low air pollution"},
+		{EUCAQI, "no2", 51, microgramsPerCubicMeter, 26, "Low air pollution"},
+		{EUCAQI, "no2", 100, microgramsPerCubicMeter, 50, "Low air pollution"},
+		{EUCAQI, "no2", 200, microgramsPerCubicMeter, 75, "Medium air pollution"},
+		{EUCAQI, "no2", 400, microgramsPerCubicMeter, 100, "High air pollution"},
+		{EUCAQI, "no2", 500, microgramsPerCubicMeter, 113, "Very high air pollution"},
+		{EUCAQI, "pm25", 15, microgramsPerCubicMeter, 25, "Very low air pollution"},
+		{EUCAQI, "pm25", 55, microgramsPerCubicMeter, 75, "Medium air pollution"},
+
+		// DAQI reports the band a concentration falls in
+		{UKDAQI, "pm25", 11, microgramsPerCubicMeter, 1, "Low air pollution"},
+		{UKDAQI, "pm25", 11.5, microgramsPerCubicMeter, 2, "Low air pollution"},
+		{UKDAQI, "pm25", 35, microgramsPerCubicMeter, 3, "Low air pollution"},
+		{UKDAQI, "pm25", 36, microgramsPerCubicMeter, 4, "Moderate air pollution"},
+		{UKDAQI, "pm25", 54, microgramsPerCubicMeter, 7, "High air pollution"},
+		{UKDAQI, "pm25", 70, microgramsPerCubicMeter, 9, "High air pollution"},
+		{UKDAQI, "pm25", 71, microgramsPerCubicMeter, 10, "Very high air pollution"},
+		{UKDAQI, "o3", 100, microgramsPerCubicMeter, 3, "Low air pollution"},
+		{UKDAQI, "o3", 101, microgramsPerCubicMeter, 4, "Moderate air pollution"},
+
+		// India's bands leave gaps between integer breakpoints
+		{IndiaAQI, "pm25", 30, microgramsPerCubicMeter, 50, "Good air quality"},
+		{IndiaAQI, "pm25", 30.5, microgramsPerCubicMeter, 51, "Satisfactory air quality"},
+		{IndiaAQI, "pm25", 31, microgramsPerCubicMeter, 51, "Satisfactory air quality"},
+		{IndiaAQI, "pm25", 61, microgramsPerCubicMeter, 101, "Moderate air quality"},
+		{IndiaAQI, "pm25", 91, microgramsPerCubicMeter, 201, "Poor air quality"},
+		{IndiaAQI, "pm25", 121, microgramsPerCubicMeter, 301, "Very poor air quality"},
+		{IndiaAQI, "pm25", 251, microgramsPerCubicMeter, 401, "Severe air quality"},
+		{IndiaAQI, "pm25", 500, microgramsPerCubicMeter, 500, "Severe air quality"},
+		{IndiaAQI, "co", 1.0, milligramsPerCubicMeter, 50, "Good air quality"},
+		{IndiaAQI, "co", 1.1, milligramsPerCubicMeter, 51, "Satisfactory air quality"},
+
+		// China
+		{ChinaAQI, "pm25", 35, microgramsPerCubicMeter, 50, "Excellent air quality"},
+		{ChinaAQI, "pm25", 36, microgramsPerCubicMeter, 51, "Good air quality"},
+		{ChinaAQI, "pm25", 75, microgramsPerCubicMeter, 100, "Good air quality"},
+		{ChinaAQI, "pm25", 115, microgramsPerCubicMeter, 150, "Light air pollution"},
+		{ChinaAQI, "pm25", 150, microgramsPerCubicMeter, 200, "Moderate air pollution"},
+		{ChinaAQI, "pm25", 250, microgramsPerCubicMeter, 300, "Heavy air pollution"},
+		{ChinaAQI, "pm25", 350, microgramsPerCubicMeter, 400, "Severe air pollution"},
+		{ChinaAQI, "pm25", 600, microgramsPerCubicMeter, 500, "Severe air pollution"},
+		{ChinaAQI, "co", 2, milligramsPerCubicMeter, 50, "Excellent air quality"},
+	}
+	for _, test := range tests {
+		result, err := Compute(test.code, map[string]models.Concentration{
+			test.pollutant: {Value: test.value, Units: test.units},
+		})
+		if err != nil {
+			t.Errorf("%s %s %v: %v", test.code, test.pollutant, test.value, err)
+			continue
+		}
+		if result.Aqi != test.aqi || result.Category != test.category {
+			t.Errorf("%s %s %v = %d %q, want %d %q", test.code, test.pollutant, test.value,
+				result.Aqi, result.Category, test.aqi, test.category)
+		}
+	}
+}
+
+func TestComputeDominantPollutant(t *testing.T) {
+	result, err := Compute(USEPA, map[string]models.Concentration{
+		"pm25": {Value: 35.5, Units: microgramsPerCubicMeter},
+		"o3":   {Value: 71, Units: partsPerBillion},
+		"no2":  {Value: 20, Units: partsPerBillion},
+		// Benzene has no breakpoints and is skipped
+		"c6h6": {Value: 5, Units: partsPerBillion},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// PM2.5 and ozone tie at 101, the first code alphabetically wins
+	if result.Aqi != 101 || result.DominantPollutant != "o3" {
+		t.Errorf("result = %d for %s, want 101 for o3", result.Aqi, result.DominantPollutant)
+	}
+	if len(result.SubIndexes) != 3 || result.SubIndexes[2].Pollutant != "no2" {
+		t.Errorf("sub-indexes = %+v, want three with no2 last", result.SubIndexes)
+	}
+
+	if _, err := Compute("unknown", nil); err == nil {
+		t.Error("unknown index computed")
+	}
+	if _, err := Compute(USEPA, map[string]models.Concentration{"c6h6": {Value: 5, Units: partsPerBillion}}); err == nil {
+		t.Error("index computed without usable pollutants")
+	}
+}
+
+func TestNowCast(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name   string
+		hourly []float64
+		want   float64
+		ok     bool
+	}{
+		{"steady", []float64{20, 20, 20, 20, 20, 20, 20, 20, 20, 20, 20, 20}, 20, true},
+		{"weight above half", []float64{30, 40}, (30 + 0.75*40) / 1.75, true},
+		// Range wider than double is weighted by the 0.5 floor
+		{"weight floor", []float64{10, 20}, (10 + 0.5*20) / 1.5, true},
+		{"missing latest hour", []float64{nan, 10, 20}, (0.5*10 + 0.25*20) / 0.75, true},
+		{"missing middle hour", []float64{10, nan, 20}, (10 + 0.25*20) / 1.25, true},
+		{"two recent hours missing", []float64{nan, nan, 10, 10}, 0, false},
+		{"one hour", []float64{10}, 0, false},
+		{"clean air", []float64{0, 0, 0}, 0, true},
+		// Only the last 12 hours count
+		{"older hours", []float64{10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 1000}, 10, true},
+	}
+	for _, test := range tests {
+		got, ok := NowCast(test.hourly)
+		if ok != test.ok || math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s: NowCast = %v, %v, want %v, %v", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
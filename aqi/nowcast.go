@@ -0,0 +1,45 @@
+package aqi
+
+import "math"
+
+// NowCast returns the US EPA NowCast of hourly particulate concentrations,
+// which tracks the 24 hour average the PM breakpoints are defined on while
+// still reacting to rapid changes. hourly holds up to the last 12 hours, most
+// recent first, with math.NaN() for missing hours. Two of the three most
+// recent hours must be present.
+func NowCast(hourly []float64) (float64, bool) {
+	if len(hourly) > 12 {
+		hourly = hourly[:12]
+	}
+	recent := 0
+	for i := 0; i < len(hourly) && i < 3; i++ {
+		if !math.IsNaN(hourly[i]) {
+			recent++
+		}
+	}
+	if recent < 2 {
+		return 0, false
+	}
+
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, value := range hourly {
+		if !math.IsNaN(value) {
+			low, high = math.Min(low, value), math.Max(high, value)
+		}
+	}
+	weight := 1.0
+	if high > 0 {
+		weight = math.Max(low/high, 0.5)
+	}
+
+	var sum, weights float64
+	for i, value := range hourly {
+		if math.IsNaN(value) {
+			continue
+		}
+		factor := math.Pow(weight, float64(i))
+		sum += factor * value
+		weights += factor
+	}
+	return sum / weights, true
+}
@@ -0,0 +1,182 @@
+package aqi
+
+import (
+	"github.com/Stutern-128/backend/models"
+	"math"
+)
+
+type breakpoint struct {
+	low, high           float64
+	indexLow, indexHigh int
+}
+
+type category struct {
+	max   int
+	name  string
+	color models.Color
+}
+
+type standard struct {
+	displayName string
+	units       map[string]string
+	breakpoints map[string][]breakpoint
+	categories  []category
+	// decimals truncates concentrations to this many decimal places before the
+	// lookup, for indexes whose breakpoints are defined on truncated values
+	decimals map[string]int
+	// extrapolate continues the last band past the table instead of capping
+	extrapolate bool
+}
+
+func (s standard) truncate(pollutant string, value float64) float64 {
+	decimals, ok := s.decimals[pollutant]
+	if !ok {
+		return value
+	}
+	scale := math.Pow10(decimals)
+	return math.Floor(value*scale) / scale
+}
+
+// rgb converts an 8 bit color to the 0-1 floats the Air Quality API uses.
+func rgb(red, green, blue int) models.Color {
+	return models.Color{Red: float64(red) / 255, Green: float64(green) / 255, Blue: float64(blue) / 255, Alpha: 1}
+}
+
+// banded builds breakpoints for indexes that report a band number instead of
+// interpolating, from the upper concentration of each band.
+func banded(highs ...float64) []breakpoint {
+	breakpoints := make([]breakpoint, len(highs))
+	low := 0.0
+	for i, high := range highs {
+		breakpoints[i] = breakpoint{low, high, i + 1, i + 1}
+		low = high
+	}
+	return breakpoints
+}
+
+var standards = map[string]standard{
+	// US EPA AQI, 2024 revision of the PM2.5 breakpoints
+	USEPA: {
+		displayName: "AQI (US)",
+		units: map[string]string{
+			"pm25": microgramsPerCubicMeter, "pm10": microgramsPerCubicMeter,
+			"o3": partsPerBillion, "no2": partsPerBillion, "so2": partsPerBillion, "co": partsPerMillion,
+		},
+		breakpoints: map[string][]breakpoint{
+			"pm25": {{0, 9.0, 0, 50}, {9.1, 35.4, 51, 100}, {35.5, 55.4, 101, 150}, {55.5, 125.4, 151, 200}, {125.5, 225.4, 201, 300}, {225.5, 325.4, 301, 500}},
+			"pm10": {{0, 54, 0, 50}, {55, 154, 51, 100}, {155, 254, 101, 150}, {255, 354, 151, 200}, {355, 424, 201, 300}, {425, 604, 301, 500}},
+			"o3":   {{0, 54, 0, 50}, {55, 70, 51, 100}, {71, 85, 101, 150}, {86, 105, 151, 200}, {106, 200, 201, 300}},
+			"co":   {{0, 4.4, 0, 50}, {4.5, 9.4, 51, 100}, {9.5, 12.4, 101, 150}, {12.5, 15.4, 151, 200}, {15.5, 30.4, 201, 300}, {30.5, 50.4, 301, 500}},
+			"so2":  {{0, 35, 0, 50}, {36, 75, 51, 100}, {76, 185, 101, 150}, {186, 304, 151, 200}, {305, 604, 201, 300}, {605, 1004, 301, 500}},
+			"no2":  {{0, 53, 0, 50}, {54, 100, 51, 100}, {101, 360, 101, 150}, {361, 649, 151, 200}, {650, 1249, 201, 300}, {1250, 2049, 301, 500}},
+		},
+		categories: []category{
+			{50, "Good air quality", rgb(0, 228, 0)},
+			{100, "Moderate air quality", rgb(255, 255, 0)},
+			{150, "Unhealthy air quality for sensitive groups", rgb(255, 126, 0)},
+			{200, "Unhealthy air quality", rgb(255, 0, 0)},
+			{300, "Very unhealthy air quality", rgb(143, 63, 151)},
+			{math.MaxInt32, "Hazardous air quality", rgb(126, 0, 35)},
+		},
+		decimals: map[string]int{"pm25": 1, "pm10": 0, "o3": 0, "no2": 0, "so2": 0, "co": 1},
+	},
+	// European Common Air Quality Index, hourly background grid
+	EUCAQI: {
+		displayName: "CAQI (EU)",
+		units: map[string]string{
+			"pm25": microgramsPerCubicMeter, "pm10": microgramsPerCubicMeter, "o3": microgramsPerCubicMeter,
+			"no2": microgramsPerCubicMeter, "so2": microgramsPerCubicMeter, "co": microgramsPerCubicMeter,
+		},
+		breakpoints: map[string][]breakpoint{
+			"no2":  {{0, 50, 0, 25}, {50, 100, 25, 50}, {100, 200, 50, 75}, {200, 400, 75, 100}},
+			"pm10": {{0, 25, 0, 25}, {25, 50, 25, 50}, {50, 90, 50, 75}, {90, 180, 75, 100}},
+			"pm25": {{0, 15, 0, 25}, {15, 30, 25, 50}, {30, 55, 50, 75}, {55, 110, 75, 100}},
+			"o3":   {{0, 60, 0, 25}, {60, 120, 25, 50}, {120, 180, 50, 75}, {180, 240, 75, 100}},
+			"co":   {{0, 5000, 0, 25}, {5000, 7500, 25, 50}, {7500, 10000, 50, 75}, {10000, 20000, 75, 100}},
+			"so2":  {{0, 50, 0, 25}, {50, 100, 25, 50}, {100, 350, 50, 75}, {350, 500, 75, 100}},
+		},
+		categories: []category{
+			{25, "Very low air pollution", rgb(121, 188, 106)},
+			{50, "Low air pollution", rgb(187, 207, 76)},
+			{75, "Medium air pollution", rgb(238, 194, 11)},
+			{100, "High air pollution", rgb(242, 147, 5)},
+			{math.MaxInt32, "Very high air pollution", rgb(232, 65, 111)},
+		},
+		extrapolate: true,
+	},
+	// UK Daily Air Quality Index, reported as bands 1 to 10
+	UKDAQI: {
+		displayName: "DAQI (UK)",
+		units: map[string]string{
+			"pm25": microgramsPerCubicMeter, "pm10": microgramsPerCubicMeter, "o3": microgramsPerCubicMeter,
+			"no2": microgramsPerCubicMeter, "so2": microgramsPerCubicMeter,
+		},
+		breakpoints: map[string][]breakpoint{
+			"o3":   banded(33, 66, 100, 120, 140, 160, 187, 213, 240, math.MaxFloat64),
+			"no2":  banded(67, 134, 200, 267, 334, 400, 467, 534, 600, math.MaxFloat64),
+			"so2":  banded(88, 177, 266, 354, 443, 532, 710, 887, 1064, math.MaxFloat64),
+			"pm25": banded(11, 23, 35, 41, 47, 53, 58, 64, 70, math.MaxFloat64),
+			"pm10": banded(16, 33, 50, 58, 66, 75, 83, 91, 100, math.MaxFloat64),
+		},
+		categories: []category{
+			{1, "Low air pollution", rgb(156, 255, 156)},
+			{2, "Low air pollution", rgb(49, 255, 0)},
+			{3, "Low air pollution", rgb(49, 207, 0)},
+			{4, "Moderate air pollution", rgb(255, 255, 0)},
+			{5, "Moderate air pollution", rgb(255, 207, 0)},
+			{6, "Moderate air pollution", rgb(255, 154, 0)},
+			{7, "High air pollution", rgb(255, 100, 100)},
+			{8, "High air pollution", rgb(255, 0, 0)},
+			{9, "High air pollution", rgb(153, 0, 0)},
+			{10, "Very high air pollution", rgb(206, 48, 255)},
+		},
+	},
+	// India National AQI (CPCB), capped at 500
+	IndiaAQI: {
+		displayName: "AQI (IN)",
+		units: map[string]string{
+			"pm25": microgramsPerCubicMeter, "pm10": microgramsPerCubicMeter, "o3": microgramsPerCubicMeter,
+			"no2": microgramsPerCubicMeter, "so2": microgramsPerCubicMeter, "co": milligramsPerCubicMeter,
+		},
+		breakpoints: map[string][]breakpoint{
+			"pm10": {{0, 50, 0, 50}, {51, 100, 51, 100}, {101, 250, 101, 200}, {251, 350, 201, 300}, {351, 430, 301, 400}, {431, 510, 401, 500}},
+			"pm25": {{0, 30, 0, 50}, {31, 60, 51, 100}, {61, 90, 101, 200}, {91, 120, 201, 300}, {121, 250, 301, 400}, {251, 380, 401, 500}},
+			"no2":  {{0, 40, 0, 50}, {41, 80, 51, 100}, {81, 180, 101, 200}, {181, 280, 201, 300}, {281, 400, 301, 400}, {401, 520, 401, 500}},
+			"o3":   {{0, 50, 0, 50}, {51, 100, 51, 100}, {101, 168, 101, 200}, {169, 208, 201, 300}, {209, 748, 301, 400}, {749, 1288, 401, 500}},
+			"co":   {{0, 1.0, 0, 50}, {1.1, 2.0, 51, 100}, {2.1, 10, 101, 200}, {10.1, 17, 201, 300}, {17.1, 34, 301, 400}, {34.1, 51, 401, 500}},
+			"so2":  {{0, 40, 0, 50}, {41, 80, 51, 100}, {81, 380, 101, 200}, {381, 800, 201, 300}, {801, 1600, 301, 400}, {1601, 2400, 401, 500}},
+		},
+		categories: []category{
+			{50, "Good air quality", rgb(0, 176, 80)},
+			{100, "Satisfactory air quality", rgb(146, 208, 80)},
+			{200, "Moderate air quality", rgb(255, 255, 0)},
+			{300, "Poor air quality", rgb(255, 153, 0)},
+			{400, "Very poor air quality", rgb(255, 0, 0)},
+			{math.MaxInt32, "Severe air quality", rgb(192, 0, 0)},
+		},
+	},
+	// China AQI (HJ 633-2012), capped at 500
+	ChinaAQI: {
+		displayName: "AQI (CN)",
+		units: map[string]string{
+			"pm25": microgramsPerCubicMeter, "pm10": microgramsPerCubicMeter, "o3": microgramsPerCubicMeter,
+			"no2": microgramsPerCubicMeter, "so2": microgramsPerCubicMeter, "co": milligramsPerCubicMeter,
+		},
+		breakpoints: map[string][]breakpoint{
+			"so2":  {{0, 50, 0, 50}, {50, 150, 50, 100}, {150, 475, 100, 150}, {475, 800, 150, 200}, {800, 1600, 200, 300}, {1600, 2100, 300, 400}, {2100, 2620, 400, 500}},
+			"no2":  {{0, 40, 0, 50}, {40, 80, 50, 100}, {80, 180, 100, 150}, {180, 280, 150, 200}, {280, 565, 200, 300}, {565, 750, 300, 400}, {750, 940, 400, 500}},
+			"pm10": {{0, 50, 0, 50}, {50, 150, 50, 100}, {150, 250, 100, 150}, {250, 350, 150, 200}, {350, 420, 200, 300}, {420, 500, 300, 400}, {500, 600, 400, 500}},
+			"co":   {{0, 2, 0, 50}, {2, 4, 50, 100}, {4, 14, 100, 150}, {14, 24, 150, 200}, {24, 36, 200, 300}, {36, 48, 300, 400}, {48, 60, 400, 500}},
+			"o3":   {{0, 160, 0, 50}, {160, 200, 50, 100}, {200, 300, 100, 150}, {300, 400, 150, 200}, {400, 800, 200, 300}, {800, 1000, 300, 400}, {1000, 1200, 400, 500}},
+			"pm25": {{0, 35, 0, 50}, {35, 75, 50, 100}, {75, 115, 100, 150}, {115, 150, 150, 200}, {150, 250, 200, 300}, {250, 350, 300, 400}, {350, 500, 400, 500}},
+		},
+		categories: []category{
+			{50, "Excellent air quality", rgb(0, 228, 0)},
+			{100, "Good air quality", rgb(255, 255, 0)},
+			{150, "Light air pollution", rgb(255, 126, 0)},
+			{200, "Moderate air pollution", rgb(255, 0, 0)},
+			{300, "Heavy air pollution", rgb(153, 0, 76)},
+			{math.MaxInt32, "Severe air pollution", rgb(126, 0, 35)},
+		},
+	},
+}
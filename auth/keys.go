@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// keyPrefix marks client API keys so they are easy to spot in logs and
+// secret scanners.
+const keyPrefix = "zk_"
+
+// prefixLength is how much of a key is kept in clear to tell keys apart.
+const prefixLength = len(keyPrefix) + 8
+
+// NewKey returns a random API key.
+func NewKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return keyPrefix + hex.EncodeToString(buf), nil
+}
+
+// Hash returns the hex SHA-256 hash under which a key is stored.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Prefix returns the leading part of a key shown in key listings.
+func Prefix(key string) string {
+	if len(key) < prefixLength {
+		return key
+	}
+	return key[:prefixLength]
+}
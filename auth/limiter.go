@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter enforces a token bucket rate limit and a daily quota per key. The
+// daily counts are kept in memory and start over at midnight UTC.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[int64]*bucket
+	days    map[int64]*dayCount
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type dayCount struct {
+	day   time.Time
+	count int
+}
+
+// Decision is the outcome of a request against the limits of a key.
+type Decision struct {
+	Allowed bool
+	// Limit and Remaining describe the token bucket; Reset is when it is full again
+	Limit     int
+	Remaining int
+	Reset     time.Time
+	// RetryAfter is how long to wait before the next request is allowed
+	RetryAfter time.Duration
+	// DailyLimit and DailyRemaining describe the daily quota
+	DailyLimit     int
+	DailyRemaining int
+	DailyReset     time.Time
+}
+
+// NewLimiter returns a limiter with no requests recorded.
+func NewLimiter() *Limiter {
+	return &Limiter{
+		buckets: make(map[int64]*bucket),
+		days:    make(map[int64]*dayCount),
+		now:     time.Now,
+	}
+}
+
+// Allow records a request for a key if its limits allow it. The bucket holds
+// ratePerMinute tokens and refills at that rate; a zero rate or quota means
+// no limit.
+func (l *Limiter) Allow(id int64, ratePerMinute int, dailyQuota int) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	today := now.UTC().Truncate(24 * time.Hour)
+	decision := Decision{Allowed: true, Limit: ratePerMinute, DailyLimit: dailyQuota, DailyReset: today.Add(24 * time.Hour)}
+
+	day, ok := l.days[id]
+	if !ok || !day.day.Equal(today) {
+		day = &dayCount{day: today}
+		l.days[id] = day
+	}
+	if dailyQuota > 0 {
+		decision.DailyRemaining = dailyQuota - day.count
+		if day.count >= dailyQuota {
+			decision.Allowed = false
+			decision.DailyRemaining = 0
+			decision.RetryAfter = decision.DailyReset.Sub(now)
+			return decision
+		}
+	}
+
+	if ratePerMinute > 0 {
+		perSecond := float64(ratePerMinute) / 60
+		b, ok := l.buckets[id]
+		if !ok {
+			b = &bucket{tokens: float64(ratePerMinute), updated: now}
+			l.buckets[id] = b
+		}
+		b.tokens = math.Min(float64(ratePerMinute), b.tokens+now.Sub(b.updated).Seconds()*perSecond)
+		b.updated = now
+		if b.tokens < 1 {
+			decision.Allowed = false
+			decision.RetryAfter = time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+		} else {
+			b.tokens--
+		}
+		decision.Remaining = int(b.tokens)
+		decision.Reset = now.Add(time.Duration((float64(ratePerMinute) - b.tokens) / perSecond * float64(time.Second)))
+		if !decision.Allowed {
+			return decision
+		}
+	}
+
+	day.count++
+	if dailyQuota > 0 {
+		decision.DailyRemaining = dailyQuota - day.count
+	}
+	return decision
+}
+
+// Forget drops the state of a key, such as one that was revoked.
+func (l *Limiter) Forget(id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.buckets, id)
+	delete(l.days, id)
+}
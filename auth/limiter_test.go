@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// clock is a settable time for the limiter.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestLimiter(start time.Time) (*Limiter, *clock) {
+	c := &clock{now: start}
+	l := NewLimiter()
+	l.now = func() time.Time { return c.now }
+	return l, c
+}
+
+func TestLimiterRate(t *testing.T) {
+	type step struct {
+		advance    time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}
+	tests := []struct {
+		name  string
+		rate  int
+		steps []step
+	}{
+		{
+			name: "burst",
+			rate: 3,
+			steps: []step{
+				{allowed: true, remaining: 2},
+				{allowed: true, remaining: 1},
+				{allowed: true, remaining: 0},
+				{allowed: false, remaining: 0, retryAfter: 20 * time.Second},
+			},
+		},
+		{
+			name: "refill",
+			rate: 60,
+			steps: []step{
+				{allowed: true, remaining: 59},
+				{advance: 500 * time.Millisecond, allowed: true, remaining: 58},
+				{advance: 2 * time.Second, allowed: true, remaining: 59},
+			},
+		},
+		{
+			name: "refill after a rejection",
+			rate: 1,
+			steps: []step{
+				{allowed: true, remaining: 0},
+				{advance: 30 * time.Second, allowed: false, remaining: 0, retryAfter: 30 * time.Second},
+				{advance: 30 * time.Second, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name: "refill caps at the burst",
+			rate: 2,
+			steps: []step{
+				{allowed: true, remaining: 1},
+				{advance: time.Hour, allowed: true, remaining: 1},
+				{allowed: true, remaining: 0},
+				{allowed: false, remaining: 0, retryAfter: 30 * time.Second},
+			},
+		},
+		{
+			name:  "unlimited",
+			rate:  0,
+			steps: []step{{allowed: true}, {allowed: true}, {allowed: true}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, c := newTestLimiter(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+			for i, s := range test.steps {
+				c.advance(s.advance)
+				d := l.Allow(1, test.rate, 0)
+				if d.Allowed != s.allowed || d.Remaining != s.remaining || d.RetryAfter.Round(time.Millisecond) != s.retryAfter {
+					t.Errorf("step %d: allowed %v, remaining %d, retry after %s, want %v, %d, %s",
+						i, d.Allowed, d.Remaining, d.RetryAfter, s.allowed, s.remaining, s.retryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterDailyQuota(t *testing.T) {
+	start := time.Date(2024, 5, 1, 23, 59, 0, 0, time.UTC)
+	midnight := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	l, c := newTestLimiter(start)
+
+	for i, wantRemaining := range []int{1, 0} {
+		d := l.Allow(1, 0, 2)
+		if !d.Allowed || d.DailyRemaining != wantRemaining || !d.DailyReset.Equal(midnight) {
+			t.Errorf("request %d: allowed %v, daily remaining %d, reset %s", i, d.Allowed, d.DailyRemaining, d.DailyReset)
+		}
+	}
+	d := l.Allow(1, 0, 2)
+	if d.Allowed || d.DailyRemaining != 0 || d.RetryAfter != time.Minute {
+		t.Errorf("over quota: allowed %v, daily remaining %d, retry after %s, want a rejection until midnight",
+			d.Allowed, d.DailyRemaining, d.RetryAfter)
+	}
+	// Other keys keep their own quota
+	if d := l.Allow(2, 0, 2); !d.Allowed {
+		t.Error("another key was rejected")
+	}
+
+	c.advance(time.Minute)
+	d = l.Allow(1, 0, 2)
+	if !d.Allowed || d.DailyRemaining != 1 || !d.DailyReset.Equal(midnight.Add(24*time.Hour)) {
+		t.Errorf("after midnight: allowed %v, daily remaining %d, reset %s, want a fresh quota",
+			d.Allowed, d.DailyRemaining, d.DailyReset)
+	}
+}
+
+func TestLimiterRateRejectionKeepsQuota(t *testing.T) {
+	l, c := newTestLimiter(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	l.Allow(1, 1, 2)
+	if d := l.Allow(1, 1, 2); d.Allowed || d.DailyRemaining != 1 {
+		t.Errorf("rate limited request: allowed %v, daily remaining %d, want rejected with 1 left", d.Allowed, d.DailyRemaining)
+	}
+	c.advance(time.Minute)
+	if d := l.Allow(1, 1, 2); !d.Allowed || d.DailyRemaining != 0 {
+		t.Errorf("allowed %v, daily remaining %d, want the last request of the day", d.Allowed, d.DailyRemaining)
+	}
+}
+
+func TestLimiterForget(t *testing.T) {
+	l, _ := newTestLimiter(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	l.Allow(1, 1, 1)
+	l.Forget(1)
+	if d := l.Allow(1, 1, 1); !d.Allowed {
+		t.Error("forgotten key is still limited")
+	}
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCacheExpiry(t *testing.T) {
+	c := New[string](50*time.Millisecond, 10)
+	c.Set("cell", "reading")
+	if value, ok := c.Get("cell"); !ok || value != "reading" {
+		t.Fatalf("Get() = %q, %v, want the fresh value", value, ok)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := c.Get("cell"); ok {
+		t.Error("Get() returned an expired value")
+	}
+	if stats := c.Stats(); stats.Entries != 0 {
+		t.Errorf("%d entries left, want the expired one dropped", stats.Entries)
+	}
+
+	// Setting a key again starts its TTL over
+	c.Set("cell", "old")
+	time.Sleep(30 * time.Millisecond)
+	c.Set("cell", "new")
+	time.Sleep(30 * time.Millisecond)
+	if value, ok := c.Get("cell"); !ok || value != "new" {
+		t.Errorf("Get() = %q, %v, want the refreshed value", value, ok)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		touch   string
+		evicted string
+	}{
+		{name: "least recently set", evicted: "0"},
+		{name: "read keeps an entry", touch: "0", evicted: "1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New[int](time.Hour, 3)
+			for i := 0; i < 3; i++ {
+				c.Set(strconv.Itoa(i), i)
+			}
+			if test.touch != "" {
+				c.Get(test.touch)
+			}
+			c.Set("3", 3)
+			if stats := c.Stats(); stats.Entries != 3 {
+				t.Errorf("%d entries, want the capacity of 3", stats.Entries)
+			}
+			for i := 0; i < 4; i++ {
+				key := strconv.Itoa(i)
+				if _, ok := c.Get(key); ok == (key == test.evicted) {
+					t.Errorf("Get(%s) found = %v", key, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	c := New[int](time.Hour, 0)
+	c.Get("a")
+	c.Set("a", 1)
+	c.Get("a")
+	c.Get("a")
+	c.Set("b", 2)
+	if stats := c.Stats(); stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 2 {
+		t.Errorf("Stats() = %+v, want 2 hits, 1 miss and 2 entries", stats)
+	}
+}
@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Disk is a file cache under a directory holding at most maxBytes. When it is
+// full the least recently used files are removed. Entries never expire on
+// their own; callers pass the oldest write time they still accept to Get.
+type Disk struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	size     int64
+	entries  map[string]*list.Element
+	order    *list.List
+	hits     int64
+	misses   int64
+}
+
+type diskEntry struct {
+	key     string
+	size    int64
+	written time.Time
+}
+
+// NewDisk returns a cache in dir, picking up the files already there.
+func NewDisk(dir string, maxBytes int64) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	d := &Disk{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+	var existing []diskEntry
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		key, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		existing = append(existing, diskEntry{key: filepath.ToSlash(key), size: info.Size(), written: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Oldest first, so the newest files end up at the front
+	sort.Slice(existing, func(i, j int) bool {
+		return existing[i].written.Before(existing[j].written)
+	})
+	for i := range existing {
+		d.entries[existing[i].key] = d.order.PushFront(&existing[i])
+		d.size += existing[i].size
+	}
+	d.evict()
+	return d, nil
+}
+
+// Get returns the file stored under key and when it was written, unless it
+// was written before notBefore. Older files are kept, so that a later Get
+// with an earlier notBefore can still fall back on them, until Set replaces
+// them or they are evicted.
+func (d *Disk) Get(key string, notBefore time.Time) ([]byte, time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if element, ok := d.entries[key]; ok {
+		e := element.Value.(*diskEntry)
+		if !e.written.Before(notBefore) {
+			data, err := os.ReadFile(d.path(key))
+			if err == nil {
+				d.order.MoveToFront(element)
+				d.hits++
+				return data, e.written, true
+			}
+			d.remove(element)
+		}
+	}
+	d.misses++
+	return nil, time.Time{}, false
+}
+
+// Set writes data under key, evicting old files to stay within the size bound.
+func (d *Disk) Set(key string, data []byte) error {
+	path := d.path(key)
+	if path == "" {
+		return errors.New("invalid cache key " + key)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write then rename, so readers never see a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if element, ok := d.entries[key]; ok {
+		d.size -= element.Value.(*diskEntry).size
+		d.order.Remove(element)
+	}
+	e := &diskEntry{key: key, size: int64(len(data)), written: time.Now()}
+	d.entries[key] = d.order.PushFront(e)
+	d.size += e.size
+	d.evict()
+	return nil
+}
+
+// Stats returns the hit and miss counts and the number of cached files.
+func (d *Disk) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return Stats{Hits: d.hits, Misses: d.misses, Entries: len(d.entries)}
+}
+
+// path maps a slash separated key to a file under the cache directory. It
+// returns "" for keys that would escape it.
+func (d *Disk) path(key string) string {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if clean == "." || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return filepath.Join(d.dir, clean)
+}
+
+func (d *Disk) evict() {
+	for d.maxBytes > 0 && d.size > d.maxBytes && d.order.Len() > 0 {
+		d.remove(d.order.Back())
+	}
+}
+
+func (d *Disk) remove(element *list.Element) {
+	e := d.order.Remove(element).(*diskEntry)
+	delete(d.entries, e.key)
+	d.size -= e.size
+	if path := d.path(e.key); path != "" {
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,26 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiskKeepsStaleFiles(t *testing.T) {
+	disk, err := NewDisk(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := disk.Set("uaqi/2/1/1.png", []byte("tile")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := disk.Get("uaqi/2/1/1.png", time.Now().Add(time.Hour)); ok {
+		t.Fatal("Get() found a file written before notBefore")
+	}
+	data, _, ok := disk.Get("uaqi/2/1/1.png", time.Time{})
+	if !ok || string(data) != "tile" {
+		t.Fatalf("Get() of the stale file = %q, %v, want the file", data, ok)
+	}
+	if stats := disk.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("Stats() = %+v, want 1 hit, 1 miss and 1 entry", stats)
+	}
+}
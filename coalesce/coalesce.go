@@ -0,0 +1,75 @@
+package coalesce
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Group merges concurrent calls with the same key into a single in-flight
+// call whose result is handed to every waiter. The zero value is ready to use.
+type Group[V any] struct {
+	// Timeout bounds each in-flight call; zero means no limit.
+	Timeout time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*call[V]
+}
+
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// Do runs fn once for all concurrent callers passing the same key. The call
+// is detached from the callers' contexts: a caller whose context is cancelled
+// stops waiting and gets ctx.Err(), while the call carries on for the
+// remaining waiters and for any side effects fn has, such as filling a cache.
+// The context fn gets still carries the values of the first caller's context.
+func (g *Group[V]) Do(ctx context.Context, key string, fn func(ctx context.Context) (V, error)) (V, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call[V])
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		c = &call[V]{done: make(chan struct{})}
+		g.calls[key] = c
+		go g.run(detached{ctx}, key, c, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (g *Group[V]) run(ctx context.Context, key string, c *call[V], fn func(ctx context.Context) (V, error)) {
+	if g.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.Timeout)
+		defer cancel()
+	}
+	c.value, c.err = fn(ctx)
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(c.done)
+}
+
+// detached keeps the values of a context but none of its deadline or
+// cancellation.
+type detached struct {
+	parent context.Context
+}
+
+func (d detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (d detached) Done() <-chan struct{}       { return nil }
+func (d detached) Err() error                  { return nil }
+func (d detached) Value(key any) any           { return d.parent.Value(key) }
@@ -0,0 +1,122 @@
+package coalesce
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupSharesCall(t *testing.T) {
+	var g Group[int]
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	const callers = 10
+	results := make(chan int, callers)
+	var started sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		started.Add(1)
+		go func() {
+			started.Done()
+			value, err := g.Do(context.Background(), "key", fn)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- value
+		}()
+	}
+	started.Wait()
+	// Let every caller join the call before it returns
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	for i := 0; i < callers; i++ {
+		if value := <-results; value != 42 {
+			t.Errorf("caller got %d, want 42", value)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("made %d calls, want 1", calls.Load())
+	}
+
+	// Other keys get their own call
+	if value, _ := g.Do(context.Background(), "other", func(ctx context.Context) (int, error) { return 7, nil }); value != 7 {
+		t.Errorf("other key got %d, want 7", value)
+	}
+}
+
+func TestGroupCancelledWaiter(t *testing.T) {
+	var g Group[string]
+	release := make(chan struct{})
+	callDone := make(chan error, 2)
+	fn := func(ctx context.Context) (string, error) {
+		<-release
+		callDone <- ctx.Err()
+		return "value", nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := g.Do(ctx, "key", fn)
+		cancelled <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	waiter := make(chan string, 1)
+	go func() {
+		value, _ := g.Do(context.Background(), "key", fn)
+		waiter <- value
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller got %v, want context.Canceled", err)
+	}
+	close(release)
+	if err := <-callDone; err != nil {
+		t.Errorf("shared call saw %v, want it to carry on", err)
+	}
+	if value := <-waiter; value != "value" {
+		t.Errorf("remaining caller got %q, want the value", value)
+	}
+}
+
+func TestGroupTimeout(t *testing.T) {
+	g := Group[int]{Timeout: 20 * time.Millisecond}
+	start := time.Now()
+	_, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+		// A hung upstream that only stops when its context does
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call took %s, want it bounded by the timeout", elapsed)
+	}
+	// The key is free again afterwards
+	if value, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) { return 1, nil }); value != 1 || err != nil {
+		t.Errorf("next call got %d, %v, want 1", value, err)
+	}
+}
+
+func TestGroupDoesNotCacheErrors(t *testing.T) {
+	var g Group[int]
+	failure := errors.New("upstream failed")
+	if _, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) { return 0, failure }); err != failure {
+		t.Fatalf("err = %v, want the upstream error", err)
+	}
+	value, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) { return 5, nil })
+	if err != nil || value != 5 {
+		t.Errorf("retry got %d, %v, want 5 from a new call", value, err)
+	}
+}
@@ -2,7 +2,7 @@ package conf
 
 import (
 	"github.com/tkanos/gonfig"
-	"log"
+	"log/slog"
 )
 
 type Configuration struct {
@@ -13,13 +13,76 @@ type Configuration struct {
 	DEFAULT_LONGITUDE    float64
 	DEFAULT_LATITUDE     float64
 	SUPPORTED_COUNTRIES  []string
+	AIR_QUALITY_PROVIDER string
+	OPENAQ_BASE_URL      string
+	OPENAQ_API_KEY       string
+	OPENAQ_RADIUS        int
+	// Current conditions and reverse geocodes are cached per geohash cell, a zero TTL disables the current conditions cache
+	CACHE_GEOHASH_PRECISION int
+	CACHE_TTL_MINUTES       int
+	CACHE_MAX_ENTRIES       int
+	// Hourly readings are kept in a local SQLite database, pruned after the retention period
+	HISTORY_DB_PATH        string
+	HISTORY_RETENTION_DAYS int
+	// Tracked locations are polled in the background and written to the history database
+	TRACKED_LOCATIONS               []TrackedLocation
+	POLLER_CONCURRENCY              int
+	POLLER_JITTER_SECONDS           int
+	POLLER_DEFAULT_INTERVAL_MINUTES int
+	// Alert subscriptions are evaluated on an interval and delivered to webhooks with retries
+	ALERTS_INTERVAL_MINUTES int
+	WEBHOOK_MAX_ATTEMPTS    int
+	WEBHOOK_BACKOFF_SECONDS int
+	WEBHOOK_TIMEOUT_SECONDS int
+	// Live AQI streams poll each watched cell on an interval and send heartbeats in between
+	STREAM_POLL_SECONDS      int
+	STREAM_HEARTBEAT_SECONDS int
+	// Pollen forecasts come from the Pollen API, limited to the listed countries when set
+	POLLEN_BASE_URL            string
+	POLLEN_SUPPORTED_COUNTRIES []string
+	// Heatmap tiles are kept on disk for the hour they were fetched in, up to the size limit
+	TILE_CACHE_DIR    string
+	TILE_CACHE_MAX_MB int
+	// Clients authenticate with API keys kept in the history database; ADMIN_API_KEY bootstraps the admin endpoints
+	AUTH_ENABLED            bool
+	ADMIN_API_KEY           string
+	API_KEY_RATE_PER_MINUTE int
+	API_KEY_DAILY_QUOTA     int
+	// CORS_ALLOWED_ORIGINS lists the browser origins allowed to call the API, an empty list allows none
+	CORS_ALLOWED_ORIGINS []string
+	// Billed upstream calls are counted per SKU, client key and endpoint and priced in USD from UPSTREAM_SKUS.
+	// Calls past the monthly budgets are refused, and optional SKUs once UPSTREAM_DEGRADE_PERCENT of a budget is spent
+	UPSTREAM_SKUS            []UpstreamSKU
+	UPSTREAM_MONTHLY_BUDGET  float64
+	UPSTREAM_DEGRADE_PERCENT int
+	// Requests and upstream calls are traced with OpenTelemetry when TRACING_EXPORTER is "otlp" or "stdout"
+	TRACING_EXPORTER      string
+	TRACING_OTLP_ENDPOINT string
+	TRACING_SAMPLE_RATIO  float64
+	// Logs are written as "text" or "json" from LOG_LEVEL ("debug", "info", "warn" or "error") up
+	LOG_FORMAT string
+	LOG_LEVEL  string
+}
+
+type TrackedLocation struct {
+	Name            string
+	Latitude        float64
+	Longitude       float64
+	IntervalMinutes int
+}
+
+type UpstreamSKU struct {
+	SKU              string
+	PricePerThousand float64
+	MonthlyBudget    float64
+	Optional         bool
 }
 
 func GetConfig() Configuration {
 	configuration := Configuration{}
 	err := gonfig.GetConf("./conf/config.json", &configuration)
 	if err != nil {
-		log.Printf("Error loading config: %s", err)
+		slog.Error("Error loading config", "error", err)
 	}
 
 	return configuration
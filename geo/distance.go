@@ -0,0 +1,22 @@
+package geo
+
+import "math"
+
+// earthRadius is the mean radius of the Earth in meters.
+const earthRadius = 6371000
+
+// Distance returns the great-circle distance in meters between two coordinates.
+func Distance(lat1 float64, lng1 float64, lat2 float64, lng2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dPhi := phi2 - phi1
+	dLambda := (lng2 - lng1) * math.Pi / 180
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Interpolate returns the coordinate a fraction of the way from the first to
+// the second coordinate. Linear interpolation is close enough over the short
+// distances between polyline vertices.
+func Interpolate(lat1 float64, lng1 float64, lat2 float64, lng2 float64, fraction float64) (float64, float64) {
+	return lat1 + (lat2-lat1)*fraction, lng1 + (lng2-lng1)*fraction
+}
@@ -0,0 +1,80 @@
+package geo
+
+import (
+	"math"
+	"time"
+)
+
+// TimedPoint is a coordinate on a path and the time it is passed, as an
+// offset from the start of the path.
+type TimedPoint struct {
+	Latitude  float64
+	Longitude float64
+	Elapsed   time.Duration
+}
+
+// Segment is a stretch of a path, with its midpoint as the place to sample it.
+type Segment struct {
+	Start  TimedPoint
+	Middle TimedPoint
+	End    TimedPoint
+	Meters float64
+}
+
+// Duration is the time spent on the segment.
+func (s Segment) Duration() time.Duration {
+	return s.End.Elapsed - s.Start.Elapsed
+}
+
+// Length returns the length of a path in meters.
+func Length(path []TimedPoint) float64 {
+	var length float64
+	for i := 1; i < len(path); i++ {
+		length += Distance(path[i-1].Latitude, path[i-1].Longitude, path[i].Latitude, path[i].Longitude)
+	}
+	return length
+}
+
+// Split cuts a path into consecutive segments of spacing meters; the last
+// one may be shorter. Times are interpolated between the path's points.
+func Split(path []TimedPoint, spacing float64) []Segment {
+	if len(path) == 0 {
+		return nil
+	}
+	cumulative := make([]float64, len(path))
+	for i := 1; i < len(path); i++ {
+		cumulative[i] = cumulative[i-1] + Distance(path[i-1].Latitude, path[i-1].Longitude, path[i].Latitude, path[i].Longitude)
+	}
+	length := cumulative[len(cumulative)-1]
+	if length == 0 || spacing <= 0 {
+		return []Segment{{Start: path[0], Middle: path[0], End: path[len(path)-1]}}
+	}
+
+	// at returns the point a distance along the path
+	at := func(distance float64) TimedPoint {
+		i := 1
+		for i < len(path)-1 && cumulative[i] < distance {
+			i++
+		}
+		from, to := path[i-1], path[i]
+		var fraction float64
+		if span := cumulative[i] - cumulative[i-1]; span > 0 {
+			fraction = math.Max(0, math.Min(1, (distance-cumulative[i-1])/span))
+		}
+		latitude, longitude := Interpolate(from.Latitude, from.Longitude, to.Latitude, to.Longitude, fraction)
+		elapsed := from.Elapsed + time.Duration(float64(to.Elapsed-from.Elapsed)*fraction)
+		return TimedPoint{Latitude: latitude, Longitude: longitude, Elapsed: elapsed}
+	}
+
+	var segments []Segment
+	for start := 0.0; start < length; start += spacing {
+		end := math.Min(start+spacing, length)
+		segments = append(segments, Segment{
+			Start:  at(start),
+			Middle: at((start + end) / 2),
+			End:    at(end),
+			Meters: end - start,
+		})
+	}
+	return segments
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"github.com/Stutern-128/backend/cache"
+	"github.com/Stutern-128/backend/metering"
+	"github.com/Stutern-128/backend/store"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// HandleCacheStats reports hit and miss counts of the upstream caches.
+func (app *App) HandleCacheStats() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		stats := fiber.Map{
+			"geocode": app.GeocodeCache.Stats(),
+			"tiles":   app.TileCache.Stats(),
+		}
+		if cached, ok := app.AirQuality.(interface{ Stats() cache.Stats }); ok {
+			stats["currentConditions"] = cached.Stats()
+		}
+		return c.Status(fiber.StatusOK).JSON(stats)
+	}
+}
+
+// HandleUsage reports the upstream calls and their estimated cost for the
+// month given as YYYY-MM in the month query parameter, by default the
+// current one.
+func (app *App) HandleUsage() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		month := c.Query("month", metering.CurrentMonth())
+		if _, err := time.Parse("2006-01", month); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid month, expected YYYY-MM",
+			})
+		}
+		report, err := app.Meter.Report(c.UserContext(), month)
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error loading upstream usage", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(report)
+	}
+}
+
+// HandleListTracked lists the locations polled in the background.
+func (app *App) HandleListTracked() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		locations, err := app.Store.TrackedLocations(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error listing tracked locations", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"configured": app.Config.TRACKED_LOCATIONS,
+			"tracked":    locations,
+		})
+	}
+}
+
+// HandleAddTracked starts polling a new location.
+func (app *App) HandleAddTracked() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		var location store.TrackedLocation
+		err := c.BodyParser(&location)
+		if err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		if err != nil || location.Latitude == 0 || location.Longitude == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid request payload",
+			})
+		}
+		if location.IntervalMinutes <= 0 {
+			location.IntervalMinutes = app.Config.POLLER_DEFAULT_INTERVAL_MINUTES
+		}
+		if err := app.Store.AddTrackedLocation(ctx, &location); err != nil {
+			slog.ErrorContext(ctx, "Error adding tracked location", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		app.Poller.Track(TrackedKey(location.ID), location)
+		return c.Status(fiber.StatusCreated).JSON(location)
+	}
+}
+
+// HandleRemoveTracked stops polling a location. Readings already stored are kept.
+func (app *App) HandleRemoveTracked() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid location id",
+			})
+		}
+		removed, err := app.Store.RemoveTrackedLocation(ctx, id)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error removing tracked location", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if !removed {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "Location not found",
+			})
+		}
+		app.Poller.Untrack(TrackedKey(id))
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"success": true,
+		})
+	}
+}
+
+// TrackedKey is the poller key of a location tracked through the admin API.
+func TrackedKey(id int64) string {
+	return "tracked:" + strconv.FormatInt(id, 10)
+}
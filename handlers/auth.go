@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"github.com/Stutern-128/backend/auth"
+	"github.com/Stutern-128/backend/metering"
+	"github.com/Stutern-128/backend/store"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	// apiKeyQuery carries the key for clients that can't set headers, such
+	// as EventSource streams and map tile images. It is only read on those
+	// routes, see queryKeyRoute, and never for admin keys.
+	apiKeyQuery = "api_key"
+	// apiKeyLocal is the fiber.Ctx local holding the authenticated *store.APIKey.
+	apiKeyLocal = "apiKey"
+)
+
+// RequireAPIKey rejects requests without a valid client API key and applies
+// the key's rate limit and daily quota, reporting both in X-RateLimit-*
+// headers. The ADMIN_API_KEY from the configuration is accepted as an
+// unlimited admin key.
+func (app *App) RequireAPIKey() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		presented, inQuery := presentedKey(c)
+		if presented == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		if inQuery && app.isAdminKey(presented) {
+			return errAdminKeyInQuery(c)
+		}
+		if app.isAdminKey(presented) {
+			c.Locals(apiKeyLocal, &store.APIKey{Name: "config", Admin: true})
+			c.SetUserContext(metering.WithClient(c.UserContext(), "config"))
+			return c.Next()
+		}
+
+		key, err := app.Store.APIKeyByHash(c.UserContext(), auth.Hash(presented))
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error loading API key", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if key == nil || key.RevokedAt != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid API key",
+			})
+		}
+		if inQuery && key.Admin {
+			return errAdminKeyInQuery(c)
+		}
+
+		decision := app.Limiter.Allow(key.ID, key.RatePerMinute, key.DailyQuota)
+		if decision.Limit > 0 {
+			c.Set("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+			c.Set("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			c.Set("X-RateLimit-Reset", strconv.FormatInt(decision.Reset.Unix(), 10))
+		}
+		if decision.DailyLimit > 0 {
+			c.Set("X-RateLimit-Daily-Limit", strconv.Itoa(decision.DailyLimit))
+			c.Set("X-RateLimit-Daily-Remaining", strconv.Itoa(decision.DailyRemaining))
+			c.Set("X-RateLimit-Daily-Reset", strconv.FormatInt(decision.DailyReset.Unix(), 10))
+		}
+		if !decision.Allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"success": false,
+				"error":   "Rate limit exceeded",
+			})
+		}
+		c.Locals(apiKeyLocal, key)
+		// Upstream calls are metered per key
+		c.SetUserContext(metering.WithClient(c.UserContext(), key.Prefix))
+		return c.Next()
+	}
+}
+
+// RequireAdmin only lets requests made with an admin key through. It must
+// run after RequireAPIKey.
+func (app *App) RequireAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key, ok := c.Locals(apiKeyLocal).(*store.APIKey)
+		if !ok || !key.Admin {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"error":   "Admin API key required",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// RequireAdminKey only lets requests made with the ADMIN_API_KEY from the
+// configuration through. It guards the admin endpoints when API key
+// authentication is disabled; without an ADMIN_API_KEY they are closed.
+func (app *App) RequireAdminKey() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !app.isAdminKey(c.Get(apiKeyHeader)) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"error":   "Admin API key required",
+			})
+		}
+		c.SetUserContext(metering.WithClient(c.UserContext(), "config"))
+		return c.Next()
+	}
+}
+
+// userID returns the owner of the saved locations, health profile and
+// subscriptions a request works on: the API key the request was made with,
+// so that no caller can act as another. It is empty without one, such as
+// when API key authentication is disabled.
+func (app *App) userID(c *fiber.Ctx) string {
+	key, ok := c.Locals(apiKeyLocal).(*store.APIKey)
+	if !ok {
+		return ""
+	}
+	if key.ID == 0 {
+		return "admin"
+	}
+	return "key:" + strconv.FormatInt(key.ID, 10)
+}
+
+// presentedKey returns the API key a request was made with, if any, and
+// whether it came from the query string, which only the routes queryKeyRoute
+// accepts are read from.
+func presentedKey(c *fiber.Ctx) (string, bool) {
+	if presented := c.Get(apiKeyHeader); presented != "" {
+		return presented, false
+	}
+	if !queryKeyRoute(c.Path()) {
+		return "", false
+	}
+	presented := c.Query(apiKeyQuery)
+	return presented, presented != ""
+}
+
+// queryKeyRoute reports whether a route takes the API key from the query
+// string: the AQI stream and map tiles, which browsers load without custom
+// headers.
+func queryKeyRoute(path string) bool {
+	return path == "/aqi/stream" || strings.HasPrefix(path, "/tiles/")
+}
+
+// errAdminKeyInQuery refuses admin keys sent in the URL, where they would end
+// up in access logs and browser history.
+func errAdminKeyInQuery(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"success": false,
+		"error":   "Admin API keys must be sent in the " + apiKeyHeader + " header",
+	})
+}
+
+// isAdminKey reports whether presented is the ADMIN_API_KEY from the
+// configuration.
+func (app *App) isAdminKey(presented string) bool {
+	admin := app.Config.ADMIN_API_KEY
+	return admin != "" && presented != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(admin)) == 1
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"github.com/Stutern-128/backend/auth"
+	"github.com/Stutern-128/backend/conf"
+	"github.com/Stutern-128/backend/store"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+const testAdminKey = "config-admin-key"
+
+// newAuthApp returns a server behind RequireAPIKey with a client key, limited
+// to rate requests a minute, and an admin key in the store.
+func newAuthApp(t *testing.T, rate int) (*fiber.App, string, string) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	keys := make([]string, 2)
+	for i, admin := range []bool{false, true} {
+		keys[i], _ = auth.NewKey()
+		key := &store.APIKey{Name: "test", Prefix: keys[i][:8], Hash: auth.Hash(keys[i]), Admin: admin, RatePerMinute: rate}
+		if err := s.AddAPIKey(context.Background(), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := &App{
+		Store:   s,
+		Limiter: auth.NewLimiter(),
+		Config:  &conf.Configuration{AUTH_ENABLED: true, ADMIN_API_KEY: testAdminKey},
+	}
+	server := fiber.New()
+	server.Use(app.RequireAPIKey())
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	server.Get("/aqi", ok)
+	server.Get("/aqi/stream", ok)
+	server.Get("/tiles/:mapType/:z/:x/:y", ok)
+	return server, keys[0], keys[1]
+}
+
+func TestRequireAPIKeyQueryParameter(t *testing.T) {
+	server, clientKey, adminKey := newAuthApp(t, 0)
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		status int
+	}{
+		{name: "header", path: "/aqi", header: clientKey, status: http.StatusOK},
+		{name: "no key", path: "/aqi", status: http.StatusUnauthorized},
+		{name: "query on a JSON route", path: "/aqi?api_key=" + clientKey, status: http.StatusUnauthorized},
+		{name: "query on the stream", path: "/aqi/stream?api_key=" + clientKey, status: http.StatusOK},
+		{name: "query on a tile", path: "/tiles/UAQI_RED_GREEN/2/1/1?api_key=" + clientKey, status: http.StatusOK},
+		{name: "stored admin key in the query", path: "/tiles/UAQI_RED_GREEN/2/1/1?api_key=" + adminKey, status: http.StatusUnauthorized},
+		{name: "config admin key in the query", path: "/aqi/stream?api_key=" + testAdminKey, status: http.StatusUnauthorized},
+		{name: "config admin key in the header", path: "/aqi/stream", header: testAdminKey, status: http.StatusOK},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.header != "" {
+			request.Header.Set(apiKeyHeader, test.header)
+		}
+		response, err := server.Test(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != test.status {
+			t.Errorf("%s: status = %d, want %d", test.name, response.StatusCode, test.status)
+		}
+	}
+}
+
+func TestRequireAPIKeyRateLimit(t *testing.T) {
+	server, clientKey, _ := newAuthApp(t, 1)
+	var statuses []int
+	var retryAfter string
+	for i := 0; i < 2; i++ {
+		request := httptest.NewRequest(http.MethodGet, "/aqi", nil)
+		request.Header.Set(apiKeyHeader, clientKey)
+		response, err := server.Test(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statuses = append(statuses, response.StatusCode)
+		retryAfter = response.Header.Get(fiber.HeaderRetryAfter)
+	}
+	if statuses[0] != http.StatusOK || statuses[1] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, want [200 429]", statuses)
+	}
+	if retryAfter != "60" {
+		t.Errorf("Retry-After = %q, want 60", retryAfter)
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/Stutern-128/backend/logging"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/Stutern-128/backend/units"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+)
+
+// maxCompareLocations is the most locations one comparison takes.
+const maxCompareLocations = 5
+
+type CompareRequest struct {
+	Locations []struct {
+		Name      string  `json:"name"`
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	} `json:"locations"`
+	PreferredIndex string `json:"preferredIndex"`
+}
+
+// comparedLocation is the outcome of the lookups for one location.
+type comparedLocation struct {
+	address    string
+	airQuality *models.AirQuality
+	err        error
+	status     int
+}
+
+// HandleCompare returns the current conditions of several locations side by
+// side, names the best and worst of them, and lists the pollutant deltas of
+// every location against the first one.
+func (app *App) HandleCompare() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		var request CompareRequest
+		if err := c.BodyParser(&request); err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		if len(request.Locations) < 2 || len(request.Locations) > maxCompareLocations {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   fmt.Sprintf("Between 2 and %d locations are required", maxCompareLocations),
+			})
+		}
+		for i, location := range request.Locations {
+			if location.Latitude == 0 || location.Longitude == 0 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"error":   "Latitude and longitude are required",
+				})
+			}
+			if location.Name == "" {
+				request.Locations[i].Name = fmt.Sprintf("Location %d", i+1)
+			}
+		}
+
+		compared := make([]comparedLocation, len(request.Locations))
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, lookupConcurrency)
+		for i, location := range request.Locations {
+			wg.Add(1)
+			go func(i int, latitude float64, longitude float64) {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				address, err := app.resolveLocation(ctx, latitude, longitude)
+				if err != nil {
+					compared[i] = comparedLocation{err: err, status: locationStatus(err)}
+					return
+				}
+				airQuality, err := app.AirQuality.CurrentConditions(ctx, providers.Request{
+					Latitude:          latitude,
+					Longitude:         longitude,
+					ExtraComputations: indexComputations,
+				})
+				if err != nil {
+					slog.ErrorContext(ctx, "Error fetching current conditions", logging.Cell(latitude, longitude), "error", err)
+					compared[i] = comparedLocation{err: err, status: upstreamStatus(err)}
+					return
+				}
+				compared[i] = comparedLocation{address: address, airQuality: airQuality}
+			}(i, location.Latitude, location.Longitude)
+		}
+		wg.Wait()
+		for i, result := range compared {
+			if result.err != nil {
+				return c.Status(result.status).JSON(fiber.Map{
+					"success": false,
+					"error":   fmt.Sprintf("%s: %s", request.Locations[i].Name, result.err),
+				})
+			}
+		}
+
+		// Align the pollutants of every location on the union of their codes
+		var codes []string
+		seen := make(map[string]bool)
+		for _, result := range compared {
+			for _, pollutant := range result.airQuality.Pollutants {
+				if !seen[pollutant.Code] {
+					seen[pollutant.Code] = true
+					codes = append(codes, pollutant.Code)
+				}
+			}
+		}
+		sort.Strings(codes)
+		baseline := pollutantsByCode(compared[0].airQuality)
+
+		var locations []interface{}
+		best, worst := -1, -1
+		var bestIndex, worstIndex models.Index
+		var aqiCode string
+		for i, result := range compared {
+			response, ok := aqiResponse(result.airQuality, result.address, request.PreferredIndex)
+			if !ok {
+				response = fiber.Map{"location": result.address}
+			}
+			response["name"] = request.Locations[i].Name
+			response["latitude"] = request.Locations[i].Latitude
+			response["longitude"] = request.Locations[i].Longitude
+
+			byCode := pollutantsByCode(result.airQuality)
+			pollutants := make([]interface{}, 0, len(codes))
+			for _, code := range codes {
+				pollutant, ok := byCode[code]
+				if !ok {
+					pollutants = append(pollutants, fiber.Map{"code": code})
+					continue
+				}
+				value := fiber.Map{
+					"code":          code,
+					"displayName":   pollutant.DisplayName,
+					"concentration": pollutant.Concentration.AddSymbol(),
+				}
+				if base, ok := baseline[code]; ok && i > 0 {
+					// Compare in the first location's units
+					converted, err := pollutant.Concentration.Convert(code, base.Concentration.Units, units.Conditions{})
+					if err == nil {
+						value["delta"] = math.Round((converted.Value-base.Concentration.Value)*100) / 100
+					}
+				}
+				pollutants = append(pollutants, value)
+			}
+			response["pollutants"] = pollutants
+			locations = append(locations, response)
+
+			index, _, ok := selectIndexes(result.airQuality, request.PreferredIndex)
+			if !ok || (aqiCode != "" && index.Code != aqiCode) {
+				continue
+			}
+			aqiCode = index.Code
+			if best < 0 || cleaner(index, bestIndex) {
+				best, bestIndex = i, index
+			}
+			if worst < 0 || cleaner(worstIndex, index) {
+				worst, worstIndex = i, index
+			}
+		}
+
+		comparison := fiber.Map{
+			"pollutantCodes": codes,
+			"locations":      locations,
+		}
+		if best >= 0 {
+			comparison["aqiCode"] = aqiCode
+			comparison["best"] = request.Locations[best].Name
+			comparison["worst"] = request.Locations[worst].Name
+		}
+		return c.Status(fiber.StatusOK).JSON(comparison)
+	}
+}
+
+// cleaner reports whether index a stands for cleaner air than index b of the
+// same code.
+func cleaner(a models.Index, b models.Index) bool {
+	if a.HigherIsBetter() {
+		return a.Aqi > b.Aqi
+	}
+	return a.Aqi < b.Aqi
+}
+
+func pollutantsByCode(airQuality *models.AirQuality) map[string]models.Pollutant {
+	pollutants := make(map[string]models.Pollutant, len(airQuality.Pollutants))
+	for _, pollutant := range airQuality.Pollutants {
+		pollutants[pollutant.Code] = pollutant
+	}
+	return pollutants
+}
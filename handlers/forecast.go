@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/Stutern-128/backend/logging"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+	"time"
+)
+
+const (
+	defaultForecastHours = 24
+	maxForecastHours     = 96
+)
+
+func (app *App) HandleForecast() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		var request LocationRequest
+		if err := c.BodyParser(&request); err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		address := "CW98+VV Mountain View, CA, USA"
+		if request.Latitude != 0 && request.Longitude != 0 {
+			var err error
+			address, err = app.resolveLocation(ctx, request.Latitude, request.Longitude)
+			if err != nil {
+				return c.Status(locationStatus(err)).JSON(fiber.Map{
+					"success": false,
+					"error":   err.Error(),
+				})
+			}
+		}
+		request.initializeDefaults(app.Config)
+		if request.Hours <= 0 {
+			request.Hours = defaultForecastHours
+		}
+		if request.Hours > maxForecastHours {
+			request.Hours = maxForecastHours
+		}
+
+		forecast, err := app.AirQuality.Forecast(ctx, providers.Request{
+			Latitude:          request.Latitude,
+			Longitude:         request.Longitude,
+			ExtraComputations: indexComputations,
+			Hours:             request.Hours,
+		})
+		if errors.Is(err, providers.ErrUnsupported) {
+			return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
+				"success": false,
+				"error":   "Forecast not available",
+			})
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Error fetching forecast", logging.Cell(request.Latitude, request.Longitude), "error", err)
+			return c.Status(upstreamStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+
+		location, _ := time.LoadLocation(request.TimeZone)
+		var hours []interface{}
+		for _, airQuality := range forecast.HoursInfo {
+			index, indexes, ok := selectIndexes(&airQuality, request.PreferredIndex)
+			if !ok {
+				continue
+			}
+			hour := fiber.Map{
+				"dateTime":              airQuality.DateTime.In(location),
+				"aqiCode":               index.Code,
+				"aqiDisplayName":        index.DisplayName,
+				"aqiValue":              index.Aqi,
+				"aqiValueDisplay":       index.AqiDisplay,
+				"aqiColor":              index.Color,
+				"aqiCategory":           index.Category,
+				"dominantPollutantCode": index.DominantPollutant,
+				"indexes":               indexes,
+			}
+			if pollutant, ok := dominantPollutant(&airQuality, index); ok {
+				hour["dominantPollutantDisplayName"] = pollutant.DisplayName
+				hour["dominantPollutantConcentration"] = pollutant.Concentration.AddSymbol()
+			}
+			hours = append(hours, hour)
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"location":   address,
+			"regionCode": forecast.RegionCode,
+			"timeZone":   request.TimeZone,
+			"hours":      hours,
+		})
+	}
+}
@@ -2,21 +2,91 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
+	"github.com/Stutern-128/backend/auth"
+	"github.com/Stutern-128/backend/cache"
+	"github.com/Stutern-128/backend/coalesce"
 	"github.com/Stutern-128/backend/conf"
+	"github.com/Stutern-128/backend/geo"
+	"github.com/Stutern-128/backend/logging"
+	"github.com/Stutern-128/backend/metering"
 	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/poller"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/Stutern-128/backend/store"
+	"github.com/Stutern-128/backend/stream"
+	"github.com/Stutern-128/backend/tracing"
+	"github.com/Stutern-128/backend/units"
 	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
 	"googlemaps.github.io/maps"
-	"log"
+	"log/slog"
 	"strings"
 	"time"
 )
 
+var (
+	errLocationNotFound     = errors.New("Location not found")
+	errLocationNotSupported = errors.New("Location not supported")
+)
+
+// MapsAPI is the part of the Google Maps client the handlers use.
+type MapsAPI interface {
+	ReverseGeocode(ctx context.Context, r *maps.GeocodingRequest) ([]maps.GeocodingResult, error)
+	FindPlaceFromText(ctx context.Context, r *maps.FindPlaceFromTextRequest) (maps.FindPlaceFromTextResponse, error)
+	Timezone(ctx context.Context, r *maps.TimezoneRequest) (*maps.TimezoneResult, error)
+	NearbySearch(ctx context.Context, r *maps.NearbySearchRequest) (maps.PlacesSearchResponse, error)
+	Directions(ctx context.Context, r *maps.DirectionsRequest) ([]maps.Route, []maps.GeocodedWaypoint, error)
+}
+
 // App holds the application state
 type App struct {
-	MapsClient *maps.Client
-	Config     *conf.Configuration
+	MapsClient   MapsAPI
+	AirQuality   providers.AirQualityProvider
+	Pollen       providers.PollenProvider
+	Tiles        providers.TileProvider
+	TileCache    *cache.Disk
+	GeocodeCache *cache.Cache[maps.GeocodingResult]
+	Store        *store.Store
+	Poller       *poller.Poller
+	Streams      *stream.Hub
+	Config       *conf.Configuration
+	Limiter      *auth.Limiter
+	Meter        *metering.Meter
+	// GeocodeCalls merges concurrent reverse geocodes of the same cell
+	GeocodeCalls coalesce.Group[maps.GeocodingResult]
+	// TileCalls merges concurrent fetches of the same heatmap tile
+	TileCalls coalesce.Group[[]byte]
+}
+
+// upstreamStatus is the status reported for a failed upstream lookup. Calls
+// refused for budget reasons are reported as temporarily unavailable.
+func upstreamStatus(err error) int {
+	if errors.Is(err, metering.ErrBudgetExceeded) {
+		return fiber.StatusServiceUnavailable
+	}
+	return fiber.StatusInternalServerError
+}
+
+// locationStatus is the status reported for a location that can't be
+// resolved: unavailable when geocoding is over budget, so that coverage can't
+// be checked, and not found otherwise.
+func locationStatus(err error) int {
+	if errors.Is(err, metering.ErrBudgetExceeded) {
+		return fiber.StatusServiceUnavailable
+	}
+	return fiber.StatusNotFound
+}
+
+// lookupConcurrency bounds the parallel upstream lookups of a single request.
+const lookupConcurrency = 8
+
+// chartRangeHours is the number of hours charted for ranges other than "day".
+// Ranges past the provider's history window are served from tracked readings.
+var chartRangeHours = map[string]int{
+	"week":  168,
+	"month": 720,
+	"year":  8760,
 }
 
 type LocationRequest struct {
@@ -25,6 +95,20 @@ type LocationRequest struct {
 	ChartRange  string  `json:"chart_range"`
 	TimeZone    string  `json:"timeZone"`
 	SearchQuery string  `json:"searchQuery"`
+	Hours       int     `json:"hours"`
+	Days        int     `json:"days"`
+	// Units optionally converts pollutant concentrations, at the given
+	// temperature in °C and pressure in hPa when set
+	Units       string   `json:"units"`
+	Temperature *float64 `json:"temperature"`
+	Pressure    *float64 `json:"pressure"`
+	// Radius in meters, place types and result limit of nearby place searches
+	Radius int      `json:"radius"`
+	Types  []string `json:"types"`
+	Limit  int      `json:"limit"`
+	// PreferredIndex is the index code (e.g. uaqi, usa_epa, gbr_defra)
+	// reported as the headline AQI
+	PreferredIndex string `json:"preferredIndex"`
 }
 
 func (r *LocationRequest) initializeDefaults(config *conf.Configuration) {
@@ -34,220 +118,241 @@ func (r *LocationRequest) initializeDefaults(config *conf.Configuration) {
 		r.TimeZone = "America/Los_Angeles"
 	}
 	r.ChartRange = strings.ToLower(r.ChartRange)
-	if r.ChartRange != "day" && strings.ToLower(r.ChartRange) != "week" {
+	if _, ok := chartRangeHours[r.ChartRange]; !ok && r.ChartRange != "day" {
 		r.ChartRange = "day"
 	}
 	// Use the "America/Los_Angeles" timezone for California
 	_, err := time.LoadLocation(r.TimeZone)
 	if err != nil {
-		log.Println("Error loading location:", err)
+		slog.Warn("Unknown time zone, using America/Los_Angeles", "timeZone", r.TimeZone, "error", err)
 		r.TimeZone = "America/Los_Angeles"
 	}
 
 }
 
-func (r *LocationRequest) getHours() int {
+// hasCoordinates reports whether the request names a location rather than
+// falling back to the default one.
+func (r *LocationRequest) hasCoordinates() bool {
+	return r.Latitude != 0 && r.Longitude != 0
+}
+
+// validCoordinates reports whether a latitude and longitude are on the globe.
+func validCoordinates(latitude float64, longitude float64) bool {
+	return latitude >= -90 && latitude <= 90 && longitude >= -180 && longitude <= 180
+}
+
+// getHours returns the number of hours before now to chart. The "day" range
+// covers today in the request's time zone, and at least the last hour.
+func (r *LocationRequest) getHours(now time.Time) int {
 	location, _ := time.LoadLocation(r.TimeZone)
 
 	// Get the current time in the specified timezone
-	currentTime := time.Now().In(location)
+	currentTime := now.In(location)
 
 	// Get the current hour
 	if r.ChartRange == "day" {
-		return currentTime.Hour()
+		return max(currentTime.Hour(), 1)
 	}
-	return 168
+	return chartRangeHours[r.ChartRange]
+}
+
+// resolveLocation reverse geocodes a coordinate and checks that the air quality
+// provider covers its country. It returns the formatted address.
+func (app *App) resolveLocation(ctx context.Context, latitude float64, longitude float64) (string, error) {
+	return app.resolveLocationFor(ctx, latitude, longitude, app.AirQuality.Supports)
 }
 
-func isSupportedCountry(element string) bool {
-	supportedCountryCodes := []string{
-		"al", "as", "ad", "ar", "am", "au", "at", "az", "bs", "bh", "bd", "by", "be", "ba", "br", "bn", "bg", "ca", "cl", "cn", "co",
-		"cr", "hr", "cy", "cz", "dk", "ec", "eg", "ee", "et", "fi", "fr", "ge", "de", "gi", "gr", "gu", "gg", "hk", "hu", "in", "id",
-		"ie", "il", "it", "jp", "je", "jo", "ke", "kr", "kw", "lv", "li", "lt", "lu", "my", "mt", "mu", "mx", "md", "mn", "me", "ma",
-		"np", "nl", "nz", "mk", "no", "pk", "pe", "ph", "pl", "pt", "pr", "qa", "re", "ro", "ru", "sa", "rs", "sg", "sk", "si", "za",
-		"es", "lk", "se", "ch", "tw", "th", "tr", "ug", "ua", "ae", "gb", "us",
+// resolveLocationFor reverse geocodes a coordinate and checks that supports
+// accepts its country. It returns the formatted address.
+func (app *App) resolveLocationFor(ctx context.Context, latitude float64, longitude float64, supports func(countryCode string) bool) (string, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "resolveLocation")
+	defer span.End()
+	cell := geo.Geohash(latitude, longitude, app.Config.CACHE_GEOHASH_PRECISION)
+	result, ok := app.GeocodeCache.Get(cell)
+	span.SetAttributes(attribute.Bool("geocode.cached", ok))
+	if !ok {
+		// Concurrent lookups for the same cell share one geocoding call
+		var err error
+		result, err = app.GeocodeCalls.Do(ctx, cell, func(ctx context.Context) (maps.GeocodingResult, error) {
+			reverseGeocodeRequest := &maps.GeocodingRequest{
+				LatLng: &maps.LatLng{
+					Lat: latitude,
+					Lng: longitude,
+				},
+			}
+			reverseGeocodeResult, err := app.MapsClient.ReverseGeocode(ctx, reverseGeocodeRequest)
+			if err != nil {
+				return maps.GeocodingResult{}, err
+			}
+			if len(reverseGeocodeResult) <= 0 {
+				return maps.GeocodingResult{}, errLocationNotFound
+			}
+			app.GeocodeCache.Set(cell, reverseGeocodeResult[0])
+			return reverseGeocodeResult[0], nil
+		})
+		if errors.Is(err, metering.ErrBudgetExceeded) {
+			// Lookups go on without the address, but only where the country
+			// doesn't matter
+			slog.WarnContext(ctx, "Skipping geocoding", logging.Cell(latitude, longitude), "error", err)
+			if supports("") {
+				return "", nil
+			}
+			return "", err
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Error reverse geocoding", logging.Cell(latitude, longitude), "error", err)
+			return "", errLocationNotFound
+		}
 	}
-	for _, code := range supportedCountryCodes {
-		if code == strings.ToLower(element) {
-			return true
+	var countryCode string
+	for _, addressComponent := range result.AddressComponents {
+		for _, typeValue := range addressComponent.Types {
+			if typeValue == "country" {
+				countryCode = addressComponent.ShortName
+				break
+			}
+		}
+		if countryCode != "" {
+			break
 		}
 	}
-	return false
+	address := result.FormattedAddress
+	slog.DebugContext(ctx, "Location resolved", logging.Cell(latitude, longitude), "country", countryCode)
+
+	if !supports(countryCode) {
+		slog.InfoContext(ctx, "Unsupported location", logging.Cell(latitude, longitude), "country", countryCode)
+		return "", errLocationNotSupported
+	}
+	return address, nil
 }
 
 func (app *App) HandleGetAQI() func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
 		var request LocationRequest
 		if err := c.BodyParser(&request); err != nil {
-			log.Printf("Invalid request payload: %s\n", err)
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
 		}
 		var address string
 		if request.Latitude == 0 || request.Longitude == 0 {
 			request.initializeDefaults(app.Config)
 			address = "CW98+VV Mountain View, CA, USA"
 		} else {
-			// Perform reverse geocoding
-			reverseGeocodeRequest := &maps.GeocodingRequest{
-				LatLng: &maps.LatLng{
-					Lat: request.Latitude,
-					Lng: request.Longitude,
-				},
-			}
-
-			reverseGeocodeResult, err := app.MapsClient.ReverseGeocode(context.Background(), reverseGeocodeRequest)
-			if err != nil || len(reverseGeocodeResult) <= 0 {
-				log.Printf("Error decode location: %s\n", err)
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-					"success": false,
-					"error":   "Location not found",
-				})
-			}
-			var countryCode string
-			for _, addressComponent := range reverseGeocodeResult[0].AddressComponents {
-				for _, typeValue := range addressComponent.Types {
-					if typeValue == "country" {
-						countryCode = addressComponent.ShortName
-						break
-					}
-				}
-				if countryCode != "" {
-					break
-				}
-			}
-			address = reverseGeocodeResult[0].FormattedAddress
-			log.Printf("Location: %s\n", address)
-
-			if !isSupportedCountry(countryCode) {
-				log.Printf("Unsupported location %s\n", err)
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			var err error
+			address, err = app.resolveLocation(ctx, request.Latitude, request.Longitude)
+			if err != nil {
+				return c.Status(locationStatus(err)).JSON(fiber.Map{
 					"success": false,
-					"error":   "Location not supported",
+					"error":   err.Error(),
 				})
 			}
-
 		}
 
-		url := fmt.Sprintf("%scurrentConditions:lookup?key=%s", app.Config.AIR_QUALITY_BASE_URL, app.Config.API_KEY)
-		agent := fiber.Post(url)
-		extraComputations := [1]string{"DOMINANT_POLLUTANT_CONCENTRATION"}
-		agent.JSON(fiber.Map{
-			"location": fiber.Map{
-				"longitude": request.Longitude,
-				"latitude":  request.Latitude,
-			},
-			"extraComputations": extraComputations,
-		}) // set body received by request
-		statusCode, body, errs := agent.Bytes()
-		if len(errs) > 0 || statusCode != 200 {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"errs": errs,
+		airQuality, err := app.AirQuality.CurrentConditions(ctx, providers.Request{
+			Latitude:          request.Latitude,
+			Longitude:         request.Longitude,
+			ExtraComputations: indexComputations,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Error fetching current conditions", logging.Cell(request.Latitude, request.Longitude), "error", err)
+			return c.Status(upstreamStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
 			})
 		}
-		var airQuality models.AirQuality
-		err := json.Unmarshal(body, &airQuality)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"err": err,
+		response, ok := aqiResponse(airQuality, address, request.PreferredIndex)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "No air quality index available",
 			})
 		}
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"dateTime":                       airQuality.DateTime,
-			"regionCode":                     airQuality.RegionCode,
-			"aqiCode":                        airQuality.Indexes[0].Code,
-			"aqiDisplayName":                 airQuality.Indexes[0].DisplayName,
-			"aqiValue":                       airQuality.Indexes[0].Aqi,
-			"aqiValueDisplay":                airQuality.Indexes[0].AqiDisplay,
-			"aqiColor":                       airQuality.Indexes[0].Color,
-			"aqiCategory":                    airQuality.Indexes[0].Category,
-			"dominantPollutantCode":          airQuality.Pollutants[0].Code,
-			"dominantPollutantDisplayName":   airQuality.Pollutants[0].DisplayName,
-			"dominantPollutantFullName":      airQuality.Pollutants[0].FullName,
-			"dominantPollutantConcentration": airQuality.Pollutants[0].Concentration,
-			"location":                       address,
-		})
+		return c.Status(fiber.StatusOK).JSON(response)
+	}
+}
+
+// aqiResponse is the body of /aqi, also sent as the /aqi/stream event data.
+// It reports false when the reading has no index or pollutant to show.
+func aqiResponse(airQuality *models.AirQuality, address string, preferredIndex string) (fiber.Map, bool) {
+	index, indexes, ok := selectIndexes(airQuality, preferredIndex)
+	if !ok {
+		return nil, false
 	}
+	pollutant, ok := dominantPollutant(airQuality, index)
+	if !ok {
+		return nil, false
+	}
+	return fiber.Map{
+		"dateTime":                       airQuality.DateTime,
+		"regionCode":                     airQuality.RegionCode,
+		"aqiCode":                        index.Code,
+		"aqiDisplayName":                 index.DisplayName,
+		"aqiValue":                       index.Aqi,
+		"aqiValueDisplay":                index.AqiDisplay,
+		"aqiColor":                       index.Color,
+		"aqiCategory":                    index.Category,
+		"dominantPollutantCode":          pollutant.Code,
+		"dominantPollutantDisplayName":   pollutant.DisplayName,
+		"dominantPollutantFullName":      pollutant.FullName,
+		"dominantPollutantConcentration": pollutant.Concentration,
+		"indexes":                        indexes,
+		"location":                       address,
+	}, true
 }
 
 func (app *App) HandleGetPollutants() func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
 		var request LocationRequest
 		if err := c.BodyParser(&request); err != nil {
-			log.Printf("Invalid request payload: %s\n", err)
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		targetUnits, ok := units.Parse(request.Units)
+		if request.Units != "" && !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Unsupported units, use ppb, ppm, µg/m³ or mg/m³",
+			})
+		}
+		conditions := units.Conditions{
+			TemperatureCelsius:  request.Temperature,
+			PressureHectopascal: request.Pressure,
 		}
 		if request.Latitude == 0 || request.Longitude == 0 {
 			request.initializeDefaults(app.Config)
-		} else {
-			// Perform reverse geocoding
-			reverseGeocodeRequest := &maps.GeocodingRequest{
-				LatLng: &maps.LatLng{
-					Lat: request.Latitude,
-					Lng: request.Longitude,
-				},
-			}
-
-			reverseGeocodeResult, err := app.MapsClient.ReverseGeocode(context.Background(), reverseGeocodeRequest)
-			if err != nil || len(reverseGeocodeResult) <= 0 {
-				log.Printf("Error decode location: %s\n", err)
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-					"success": false,
-					"error":   "Location not found",
-				})
-			}
-			var countryCode string
-			for _, addressComponent := range reverseGeocodeResult[0].AddressComponents {
-				for _, typeValue := range addressComponent.Types {
-					if typeValue == "country" {
-						countryCode = addressComponent.ShortName
-						break
-					}
-				}
-				if countryCode != "" {
-					break
-				}
-			}
-			address := reverseGeocodeResult[0].FormattedAddress
-			log.Printf("Location: %s\n", address)
-
-			if !isSupportedCountry(countryCode) {
-				log.Printf("Unsupported location %s\n", err)
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-					"success": false,
-					"error":   "Location not supported",
-				})
-			}
-
-		}
-
-		url := fmt.Sprintf("%scurrentConditions:lookup?key=%s", app.Config.AIR_QUALITY_BASE_URL, app.Config.API_KEY)
-		agent := fiber.Post(url)
-		extraComputations := [1]string{"POLLUTANT_CONCENTRATION"}
-		agent.JSON(fiber.Map{
-			"location": fiber.Map{
-				"longitude": request.Longitude,
-				"latitude":  request.Latitude,
-			},
-			"extraComputations": extraComputations,
-		}) // set body received by request
-		statusCode, body, errs := agent.Bytes()
-		if len(errs) > 0 || statusCode != 200 {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"errs": errs,
+		} else if _, err := app.resolveLocation(ctx, request.Latitude, request.Longitude); err != nil {
+			return c.Status(locationStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
 			})
 		}
-		var airQuality models.AirQuality
-		err := json.Unmarshal(body, &airQuality)
+
+		airQuality, err := app.AirQuality.CurrentConditions(ctx, providers.Request{
+			Latitude:          request.Latitude,
+			Longitude:         request.Longitude,
+			ExtraComputations: []string{"POLLUTANT_CONCENTRATION"},
+		})
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"err": err,
+			slog.ErrorContext(ctx, "Error fetching current conditions", logging.Cell(request.Latitude, request.Longitude), "error", err)
+			return c.Status(upstreamStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
 			})
 		}
 		var pollutantValues []interface{}
 		for _, pollutant := range airQuality.Pollutants {
+			concentration := pollutant.Concentration
+			if targetUnits != "" {
+				// Particulates have no mixing ratio and keep their mass units
+				if converted, err := concentration.Convert(pollutant.Code, targetUnits, conditions); err == nil {
+					concentration = converted
+				}
+			}
 			pollutantValues = append(pollutantValues, fiber.Map{
 				"pollutantCode":          pollutant.Code,
 				"pollutantDisplayName":   pollutant.DisplayName,
 				"pollutantFullName":      pollutant.FullName,
-				"pollutantConcentration": pollutant.Concentration.AddSymbol(),
+				"pollutantConcentration": concentration.AddSymbol(),
 			})
 		}
 		return c.Status(fiber.StatusOK).JSON(pollutantValues)
@@ -256,75 +361,30 @@ func (app *App) HandleGetPollutants() func(c *fiber.Ctx) error {
 
 func (app *App) HandleGetPollutantsAdditionalInfo() func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
 		var request LocationRequest
 		if err := c.BodyParser(&request); err != nil {
-			log.Printf("Invalid request payload: %s\n", err)
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
 		}
 		if request.Latitude == 0 || request.Longitude == 0 {
 			request.initializeDefaults(app.Config)
-		} else {
-			// Perform reverse geocoding
-			reverseGeocodeRequest := &maps.GeocodingRequest{
-				LatLng: &maps.LatLng{
-					Lat: request.Latitude,
-					Lng: request.Longitude,
-				},
-			}
-
-			reverseGeocodeResult, err := app.MapsClient.ReverseGeocode(context.Background(), reverseGeocodeRequest)
-			if err != nil || len(reverseGeocodeResult) <= 0 {
-				log.Printf("Error decode location: %s\n", err)
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-					"success": false,
-					"error":   "Location not found",
-				})
-			}
-			var countryCode string
-			for _, addressComponent := range reverseGeocodeResult[0].AddressComponents {
-				for _, typeValue := range addressComponent.Types {
-					if typeValue == "country" {
-						countryCode = addressComponent.ShortName
-						break
-					}
-				}
-				if countryCode != "" {
-					break
-				}
-			}
-			address := reverseGeocodeResult[0].FormattedAddress
-			log.Printf("Location: %s\n", address)
-
-			if !isSupportedCountry(countryCode) {
-				log.Printf("Unsupported location %s\n", err)
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-					"success": false,
-					"error":   "Location not supported",
-				})
-			}
-
-		}
-
-		url := fmt.Sprintf("%scurrentConditions:lookup?key=%s", app.Config.AIR_QUALITY_BASE_URL, app.Config.API_KEY)
-		agent := fiber.Post(url)
-		extraComputations := []string{"POLLUTANT_CONCENTRATION", "POLLUTANT_ADDITIONAL_INFO"}
-		agent.JSON(fiber.Map{
-			"location": fiber.Map{
-				"longitude": request.Longitude,
-				"latitude":  request.Latitude,
-			},
-			"extraComputations": extraComputations,
-		}) // set body received by request
-		statusCode, body, errs := agent.Bytes()
-		if len(errs) > 0 || statusCode != 200 {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"errs": errs,
+		} else if _, err := app.resolveLocation(ctx, request.Latitude, request.Longitude); err != nil {
+			return c.Status(locationStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
 			})
 		}
-		var airQuality models.AirQuality
-		err := json.Unmarshal(body, &airQuality)
+
+		airQuality, err := app.AirQuality.CurrentConditions(ctx, providers.Request{
+			Latitude:          request.Latitude,
+			Longitude:         request.Longitude,
+			ExtraComputations: []string{"POLLUTANT_CONCENTRATION", "POLLUTANT_ADDITIONAL_INFO"},
+		})
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"err": err,
+			slog.ErrorContext(ctx, "Error fetching current conditions", logging.Cell(request.Latitude, request.Longitude), "error", err)
+			return c.Status(upstreamStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
 			})
 		}
 		var pollutantValues []interface{}
@@ -343,114 +403,90 @@ func (app *App) HandleGetPollutantsAdditionalInfo() func(c *fiber.Ctx) error {
 
 func (app *App) HandleChart() func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
 		var request LocationRequest
 		if err := c.BodyParser(&request); err != nil {
-			log.Printf("Invalid request payload: %s\n", err)
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
 		}
-		if request.Latitude > 0 && request.Longitude > 0 {
-			// Perform reverse geocoding
-			reverseGeocodeRequest := &maps.GeocodingRequest{
-				LatLng: &maps.LatLng{
-					Lat: request.Latitude,
-					Lng: request.Longitude,
-				},
-			}
-
-			reverseGeocodeResult, err := app.MapsClient.ReverseGeocode(context.Background(), reverseGeocodeRequest)
-			if err != nil || len(reverseGeocodeResult) <= 0 {
-				log.Printf("Error decode location: %s\n", err)
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		if request.hasCoordinates() {
+			if !validCoordinates(request.Latitude, request.Longitude) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 					"success": false,
-					"error":   "Location not found",
+					"error":   "Invalid latitude or longitude",
 				})
 			}
-			var countryCode string
-			for _, addressComponent := range reverseGeocodeResult[0].AddressComponents {
-				for _, typeValue := range addressComponent.Types {
-					if typeValue == "country" {
-						countryCode = addressComponent.ShortName
-						break
-					}
-				}
-				if countryCode != "" {
-					break
-				}
-			}
-			address := reverseGeocodeResult[0].FormattedAddress
-			log.Printf("Location: %s\n", address)
-			if !isSupportedCountry(countryCode) {
-				log.Printf("Unsupported location %s\n", err)
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			if _, err := app.resolveLocation(ctx, request.Latitude, request.Longitude); err != nil {
+				return c.Status(locationStatus(err)).JSON(fiber.Map{
 					"success": false,
-					"error":   "Location not supported",
+					"error":   err.Error(),
 				})
 			}
 		}
 		request.initializeDefaults(app.Config)
-		extraComputations := []string{"DOMINANT_POLLUTANT_CONCENTRATION"}
 
-		var airQualities models.AirQualities
+		to := time.Now().Truncate(time.Hour)
+		from := to.Add(-time.Duration(request.getHours(to)) * time.Hour)
+		hoursInfo, err := app.hourlyHistory(ctx, request.Latitude, request.Longitude, from, to)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error fetching history", logging.Cell(request.Latitude, request.Longitude), "error", err)
+			return c.Status(upstreamStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if len(hoursInfo) == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "No history available",
+			})
+		}
 		var aqiValues []interface{}
 		var dominantPollutantValues []interface{}
 		var totalAqi int
 		var totalDominantPollutantConcentration float64
-		var firstAqiValue float64
-		var lastAqiValue float64
-		size := request.getHours()
-		for size > 0 {
-			url := fmt.Sprintf("%shistory:lookup?key=%s", app.Config.AIR_QUALITY_BASE_URL, app.Config.API_KEY)
-			agent := fiber.Post(url)
-			agent.JSON(fiber.Map{
-				"location": fiber.Map{
-					"longitude": &request.Longitude,
-					"latitude":  &request.Latitude,
-				},
-				"extraComputations": extraComputations,
-				"hours":             request.getHours(),
-				"pageToken":         airQualities.NextPageToken,
-				"pageSize":          72,
-			}) // set body received by request
-			statusCode, body, errs := agent.Bytes()
-			if len(errs) > 0 || statusCode != 200 {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"errs": errs,
-				})
+		var firstAqiValue, lastAqiValue float64
+		for _, airQuality := range hoursInfo {
+			index, indexes, ok := selectIndexes(&airQuality, request.PreferredIndex)
+			if !ok {
+				continue
 			}
-			err := json.Unmarshal(body, &airQualities)
-			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"err": err,
-				})
-			}
-			for _, airQuality := range airQualities.HoursInfo {
-				totalAqi += airQuality.Indexes[0].Aqi
-				totalDominantPollutantConcentration += airQuality.Pollutants[0].Concentration.Value
-				aqiValues = append(aqiValues, fiber.Map{
-					"dateTime":        airQuality.DateTime,
-					"aqiCode":         airQuality.Indexes[0].Code,
-					"aqiDisplayName":  airQuality.Indexes[0].DisplayName,
-					"aqiValue":        airQuality.Indexes[0].Aqi,
-					"aqiValueDisplay": airQuality.Indexes[0].AqiDisplay,
-				})
-				dominantPollutantValues = append(dominantPollutantValues, fiber.Map{
-					"dominantPollutantCode":          airQuality.Indexes[0].DominantPollutant,
-					"dominantPollutantDisplayName":   airQuality.Pollutants[0].DisplayName,
-					"dominantPollutantConcentration": airQuality.Pollutants[0].Concentration.AddSymbol(),
-				})
+			pollutant, ok := dominantPollutant(&airQuality, index)
+			if !ok {
+				continue
 			}
-			if firstAqiValue == 0 {
-				firstAqiValue = float64(airQualities.HoursInfo[0].Indexes[0].Aqi)
+			if len(aqiValues) == 0 {
+				firstAqiValue = float64(index.Aqi)
 			}
-			lastAqiValue = float64(airQualities.HoursInfo[len(airQualities.HoursInfo)-1].Indexes[0].Aqi)
-			size -= len(airQualities.HoursInfo)
+			lastAqiValue = float64(index.Aqi)
+			totalAqi += index.Aqi
+			totalDominantPollutantConcentration += pollutant.Concentration.Value
+			aqiValues = append(aqiValues, fiber.Map{
+				"dateTime":        airQuality.DateTime,
+				"aqiCode":         index.Code,
+				"aqiDisplayName":  index.DisplayName,
+				"aqiValue":        index.Aqi,
+				"aqiValueDisplay": index.AqiDisplay,
+				"indexes":         indexes,
+			})
+			dominantPollutantValues = append(dominantPollutantValues, fiber.Map{
+				"dominantPollutantCode":          index.DominantPollutant,
+				"dominantPollutantDisplayName":   pollutant.DisplayName,
+				"dominantPollutantConcentration": pollutant.Concentration.AddSymbol(),
+			})
+		}
+		if len(aqiValues) == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "No history available",
+			})
 		}
 
 		changeInAqi := (firstAqiValue - lastAqiValue) / firstAqiValue
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
 			"aqis":                          aqiValues,
 			"dominantPollutants":            dominantPollutantValues,
-			"averageAqiValue":               totalAqi / len(airQualities.HoursInfo),
-			"averageDominantPollutantValue": totalDominantPollutantConcentration / float64(len(airQualities.HoursInfo)),
+			"averageAqiValue":               totalAqi / len(aqiValues),
+			"averageDominantPollutantValue": totalDominantPollutantConcentration / float64(len(aqiValues)),
 			"percentageChangeInAqi":         changeInAqi * 100,
 		})
 	}
@@ -458,9 +494,13 @@ func (app *App) HandleChart() func(c *fiber.Ctx) error {
 
 func (app *App) HandleSearch() func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
 		var request LocationRequest
-		if err := c.BodyParser(&request); err != nil || request.SearchQuery == "" {
-			log.Printf("Invalid request payload: %s\n", err)
+		err := c.BodyParser(&request)
+		if err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		if err != nil || request.SearchQuery == "" {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"success": false,
 				"error":   "Invalid request payload",
@@ -471,9 +511,11 @@ func (app *App) HandleSearch() func(c *fiber.Ctx) error {
 			Input:     request.SearchQuery,
 			InputType: maps.FindPlaceFromTextInputTypeTextQuery,
 		}
-		fromTextResponse, err := app.MapsClient.FindPlaceFromText(context.Background(), testInputRequest)
+		fromTextResponse, err := app.MapsClient.FindPlaceFromText(ctx, testInputRequest)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error finding place", "error", err)
+		}
 		if err != nil || len(fromTextResponse.Candidates) <= 0 {
-			log.Printf("Error decode location: %s\n", err)
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"success": false,
 				"error":   "No location found",
@@ -487,9 +529,9 @@ func (app *App) HandleSearch() func(c *fiber.Ctx) error {
 				Location: &maps.LatLng{Lat: lat, Lng: lng},
 			}
 			var timeZone string
-			timezoneResult, err := app.MapsClient.Timezone(context.Background(), timezoneRequest)
+			timezoneResult, err := app.MapsClient.Timezone(ctx, timezoneRequest)
 			if err != nil {
-				log.Printf("Error getting timezone information: %v", err)
+				slog.WarnContext(ctx, "Error getting time zone", "error", err)
 			} else {
 				timeZone = timezoneResult.TimeZoneName
 			}
@@ -504,120 +546,3 @@ func (app *App) HandleSearch() func(c *fiber.Ctx) error {
 	}
 
 }
-
-func (app *App) HandleNearByPlaces() func(c *fiber.Ctx) error {
-	return func(c *fiber.Ctx) error {
-		var request LocationRequest
-		if err := c.BodyParser(&request); err != nil {
-			log.Printf("Invalid request payload: %s\n", err)
-		}
-		if request.Latitude > 0 && request.Longitude > 0 {
-			// Perform reverse geocoding
-			reverseGeocodeRequest := &maps.GeocodingRequest{
-				LatLng: &maps.LatLng{
-					Lat: request.Latitude,
-					Lng: request.Longitude,
-				},
-			}
-
-			reverseGeocodeResult, err := app.MapsClient.ReverseGeocode(context.Background(), reverseGeocodeRequest)
-			if err != nil || len(reverseGeocodeResult) <= 0 {
-				log.Printf("Error decode location: %s\n", err)
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-					"success": false,
-					"error":   "Location not found",
-				})
-			}
-			var countryCode string
-			for _, addressComponent := range reverseGeocodeResult[0].AddressComponents {
-				for _, typeValue := range addressComponent.Types {
-					if typeValue == "country" {
-						countryCode = addressComponent.ShortName
-						break
-					}
-				}
-				if countryCode != "" {
-					break
-				}
-			}
-			address := reverseGeocodeResult[0].FormattedAddress
-			log.Printf("Location: %s\n", address)
-			if !isSupportedCountry(countryCode) {
-				log.Printf("Unsupported location %s\n", err)
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-					"success": false,
-					"error":   "Location not supported",
-				})
-			}
-		}
-		// Define the request parameters
-		radius := 50000 // Radius in meters
-		//types := []string{"restaurant", "bar", "cafe", "park", "store"} // Place types you are interested in
-
-		// Make the nearby search request
-		req := &maps.NearbySearchRequest{
-			Location: &maps.LatLng{Lat: request.Latitude, Lng: request.Latitude},
-			Radius:   uint(radius),
-		}
-
-		resp, err := app.MapsClient.NearbySearch(context.Background(), req)
-		if err != nil {
-			log.Printf("Unsupported location %s\n", err)
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"success": false,
-				"error":   "Can't resolve nearby places",
-			})
-		}
-
-		// Print the results with latitude and longitude
-		var aqiValues []interface{}
-		for index, result := range resp.Results {
-			if index == 2 {
-				break
-			}
-			log.Printf("Name: %s, Location: Lat %v, Lng %v\n", result.Name, result.Geometry.Location.Lat, result.Geometry.Location.Lng)
-
-			url := fmt.Sprintf("%scurrentConditions:lookup?key=%s", app.Config.AIR_QUALITY_BASE_URL, app.Config.API_KEY)
-			agent := fiber.Post(url)
-			extraComputations := [1]string{"DOMINANT_POLLUTANT_CONCENTRATION"}
-			agent.JSON(fiber.Map{
-				"location": fiber.Map{
-					"longitude": result.Geometry.Location.Lng,
-					"latitude":  result.Geometry.Location.Lat,
-				},
-				"extraComputations": extraComputations,
-			}) // set body received by request
-			statusCode, body, errs := agent.Bytes()
-			if len(errs) > 0 || statusCode != 200 {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"errs": errs,
-				})
-			}
-			var airQuality models.AirQuality
-			err := json.Unmarshal(body, &airQuality)
-			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"err": err,
-				})
-			}
-			aqiValues = append(aqiValues, fiber.Map{
-				"dateTime":                       airQuality.DateTime,
-				"regionCode":                     airQuality.RegionCode,
-				"aqiCode":                        airQuality.Indexes[0].Code,
-				"aqiDisplayName":                 airQuality.Indexes[0].DisplayName,
-				"aqiValue":                       airQuality.Indexes[0].Aqi,
-				"aqiValueDisplay":                airQuality.Indexes[0].AqiDisplay,
-				"aqiColor":                       airQuality.Indexes[0].Color,
-				"aqiCategory":                    airQuality.Indexes[0].Category,
-				"dominantPollutantCode":          airQuality.Pollutants[0].Code,
-				"dominantPollutantDisplayName":   airQuality.Pollutants[0].DisplayName,
-				"dominantPollutantFullName":      airQuality.Pollutants[0].FullName,
-				"dominantPollutantConcentration": airQuality.Pollutants[0].Concentration,
-				"location":                       result.FormattedAddress,
-				"Name":                           result.Name,
-				"Vicinity":                       result.Vicinity,
-			})
-		}
-		return c.Status(fiber.StatusOK).JSON(aqiValues)
-	}
-}
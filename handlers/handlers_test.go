@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/Stutern-128/backend/cache"
+	"github.com/Stutern-128/backend/conf"
+	"github.com/Stutern-128/backend/metering"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/Stutern-128/backend/track"
+	"github.com/gofiber/fiber/v2"
+	"googlemaps.github.io/maps"
+	"testing"
+	"time"
+)
+
+// overBudgetMaps refuses every geocode like a degraded meter does.
+type overBudgetMaps struct {
+	MapsAPI
+}
+
+func (m *overBudgetMaps) ReverseGeocode(ctx context.Context, r *maps.GeocodingRequest) ([]maps.GeocodingResult, error) {
+	return nil, metering.ErrBudgetExceeded
+}
+
+func TestResolveLocationOverBudget(t *testing.T) {
+	app := &App{
+		MapsClient:   &overBudgetMaps{},
+		GeocodeCache: cache.New[maps.GeocodingResult](time.Hour, 100),
+		Config:       &conf.Configuration{CACHE_GEOHASH_PRECISION: 6},
+	}
+	ctx := context.Background()
+
+	// Without the country, coverage can't be confirmed
+	supportsUS := func(countryCode string) bool { return countryCode == "US" }
+	_, err := app.resolveLocationFor(ctx, 37.42, -122.08, supportsUS)
+	if !errors.Is(err, metering.ErrBudgetExceeded) || locationStatus(err) != fiber.StatusServiceUnavailable {
+		t.Errorf("err = %v with status %d, want a budget error with 503", err, locationStatus(err))
+	}
+
+	// Providers covering every country go on without the address
+	supportsAll := func(countryCode string) bool { return true }
+	address, err := app.resolveLocationFor(ctx, 37.42, -122.08, supportsAll)
+	if err != nil || address != "" {
+		t.Errorf("address = %q, err = %v, want no address and no error", address, err)
+	}
+}
+
+// borderMaps places coordinates west of the prime meridian in the United
+// States and the rest in France.
+type borderMaps struct {
+	MapsAPI
+}
+
+func (m *borderMaps) ReverseGeocode(ctx context.Context, r *maps.GeocodingRequest) ([]maps.GeocodingResult, error) {
+	country := "FR"
+	if r.LatLng.Lng < 0 {
+		country = "US"
+	}
+	return []maps.GeocodingResult{{
+		FormattedAddress:  country,
+		AddressComponents: []maps.AddressComponent{{ShortName: country, Types: []string{"country"}}},
+	}}, nil
+}
+
+// usOnly covers the United States only.
+type usOnly struct {
+	providers.AirQualityProvider
+}
+
+func (usOnly) Supports(countryCode string) bool { return countryCode == "US" }
+
+func TestCheckTrackCells(t *testing.T) {
+	app := &App{
+		MapsClient:   &borderMaps{},
+		AirQuality:   usOnly{},
+		GeocodeCache: cache.New[maps.GeocodingResult](time.Hour, 100),
+		Config:       &conf.Configuration{CACHE_GEOHASH_PRECISION: 6},
+	}
+	start := time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		longitudes []float64
+		err        error
+	}{
+		{"inside coverage", []float64{-2, -1}, nil},
+		{"starts inside and leaves", []float64{-1, 1}, errLocationNotSupported},
+		{"starts outside", []float64{1, -1}, errLocationNotSupported},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var points []track.Point
+			for i, longitude := range test.longitudes {
+				points = append(points, track.Point{Latitude: 45, Longitude: longitude, Time: start.Add(time.Duration(i) * time.Minute)})
+			}
+			_, ranges := splitTrack([][]track.Point{points}, 6)
+			if err := app.checkTrackCells(context.Background(), ranges); !errors.Is(err, test.err) {
+				t.Errorf("err = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestGetHours(t *testing.T) {
+	tests := []struct {
+		name       string
+		chartRange string
+		now        time.Time
+		want       int
+	}{
+		{"day during the first local hour", "day", time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC), 1},
+		{"day in the afternoon", "day", time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC), 15},
+		{"week", "week", time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC), 168},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Los Angeles is UTC-7 in May
+			request := LocationRequest{ChartRange: test.chartRange, TimeZone: "America/Los_Angeles"}
+			if got := request.getHours(test.now); got != test.want {
+				t.Errorf("getHours = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
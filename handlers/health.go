@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"github.com/Stutern-128/backend/logging"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/Stutern-128/backend/store"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+)
+
+// allHealthGroups are the groups shown to callers without a health profile.
+var allHealthGroups = []string{
+	models.LungDiseasePopulation,
+	models.HeartDiseasePopulation,
+	models.Elderly,
+	models.Children,
+	models.PregnantWomen,
+	models.Athletes,
+}
+
+type HealthProfileRequest struct {
+	Groups []string `json:"groups"`
+}
+
+// HandleGetHealth returns the health recommendations for a location, limited
+// to the groups in the caller's profile and ranked by severity.
+func (app *App) HandleGetHealth() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		var request LocationRequest
+		if err := c.BodyParser(&request); err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		var address string
+		if request.Latitude == 0 || request.Longitude == 0 {
+			request.initializeDefaults(app.Config)
+			address = "CW98+VV Mountain View, CA, USA"
+		} else {
+			var err error
+			address, err = app.resolveLocation(ctx, request.Latitude, request.Longitude)
+			if err != nil {
+				return c.Status(locationStatus(err)).JSON(fiber.Map{
+					"success": false,
+					"error":   err.Error(),
+				})
+			}
+		}
+
+		groups := allHealthGroups
+		var profile *store.HealthProfile
+		if userID := app.userID(c); userID != "" && app.Store != nil {
+			var err error
+			profile, err = app.Store.HealthProfile(ctx, userID)
+			if err != nil {
+				slog.ErrorContext(ctx, "Error loading health profile", "error", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"success": false,
+					"error":   err.Error(),
+				})
+			}
+			if profile != nil {
+				groups = profile.Groups
+			}
+		}
+
+		airQuality, err := app.AirQuality.CurrentConditions(ctx, providers.Request{
+			Latitude:          request.Latitude,
+			Longitude:         request.Longitude,
+			ExtraComputations: append([]string{"HEALTH_RECOMMENDATIONS"}, indexComputations...),
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Error fetching current conditions", logging.Cell(request.Latitude, request.Longitude), "error", err)
+			return c.Status(upstreamStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		index, _, ok := selectIndexes(airQuality, request.PreferredIndex)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "No air quality index available",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"dateTime":        airQuality.DateTime,
+			"location":        address,
+			"aqiCode":         index.Code,
+			"aqiValue":        index.Aqi,
+			"aqiCategory":     index.Category,
+			"profile":         profile,
+			"recommendations": airQuality.HealthRecommendations.Rank(index, groups),
+		})
+	}
+}
+
+func (app *App) HandleGetHealthProfile() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		profile, err := app.Store.HealthProfile(ctx, userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error loading health profile", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if profile == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "Health profile not found",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(profile)
+	}
+}
+
+// HandleSaveHealthProfile creates or replaces the caller's health profile.
+func (app *App) HandleSaveHealthProfile() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		var request HealthProfileRequest
+		if err := c.BodyParser(&request); err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		profile := store.HealthProfile{UserID: userID, Groups: []string{}}
+		for _, group := range request.Groups {
+			if !models.IsHealthGroup(group) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"error":   "Unknown group " + group,
+				})
+			}
+			if group != models.GeneralPopulation {
+				profile.Groups = append(profile.Groups, group)
+			}
+		}
+		if err := app.Store.SaveHealthProfile(ctx, &profile); err != nil {
+			slog.ErrorContext(ctx, "Error saving health profile", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(profile)
+	}
+}
+
+func (app *App) HandleDeleteHealthProfile() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		removed, err := app.Store.RemoveHealthProfile(ctx, userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error removing health profile", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if !removed {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "Health profile not found",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"success": true,
+		})
+	}
+}
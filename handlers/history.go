@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"github.com/Stutern-128/backend/geo"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/Stutern-128/backend/store"
+	"github.com/Stutern-128/backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// historyWindow is how far back the provider can look up history.
+const historyWindow = 30 * 24 * time.Hour
+
+// hourlyHistory returns the readings for the hours in [from, to), oldest
+// first. Hours already in the local store are read from disk and only the
+// missing ones within the history window are fetched from the provider and
+// saved.
+func (app *App) hourlyHistory(ctx context.Context, latitude float64, longitude float64, from time.Time, to time.Time) ([]models.AirQuality, error) {
+	from, to = from.UTC().Truncate(time.Hour), to.UTC().Truncate(time.Hour)
+	ctx, span := tracing.Tracer.Start(ctx, "hourlyHistory", trace.WithAttributes(
+		attribute.String("from", from.Format(time.RFC3339)),
+		attribute.String("to", to.Format(time.RFC3339)),
+	))
+	defer span.End()
+	if app.Store == nil {
+		if windowStart := time.Now().UTC().Truncate(time.Hour).Add(-historyWindow); from.Before(windowStart) {
+			from = windowStart
+		}
+		history, err := app.AirQuality.History(ctx, providers.Request{
+			Latitude:          latitude,
+			Longitude:         longitude,
+			ExtraComputations: store.ReadingComputations,
+			Start:             from,
+			End:               to,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return history.HoursInfo, nil
+	}
+
+	cell := geo.Geohash(latitude, longitude, app.Config.CACHE_GEOHASH_PRECISION)
+	readings, err := app.Store.Readings(ctx, cell, from, to)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[time.Time]bool, len(readings))
+	for _, reading := range readings {
+		stored[reading.DateTime.UTC().Truncate(time.Hour)] = true
+	}
+
+	// Fetch each contiguous run of missing hours with one history lookup
+	var fetched []models.AirQuality
+	start := from
+	if windowStart := time.Now().UTC().Truncate(time.Hour).Add(-historyWindow); start.Before(windowStart) {
+		start = windowStart
+	}
+	for start.Before(to) {
+		if stored[start] {
+			start = start.Add(time.Hour)
+			continue
+		}
+		end := start
+		for end.Before(to) && !stored[end] {
+			end = end.Add(time.Hour)
+		}
+		history, err := app.AirQuality.History(ctx, providers.Request{
+			Latitude:          latitude,
+			Longitude:         longitude,
+			ExtraComputations: store.ReadingComputations,
+			Start:             start,
+			End:               end,
+		})
+		if err != nil {
+			return nil, err
+		}
+		fetched = append(fetched, history.HoursInfo...)
+		start = end
+	}
+	if len(fetched) > 0 {
+		if err := app.Store.SaveReadings(ctx, cell, fetched); err != nil {
+			slog.ErrorContext(ctx, "Error saving history", "error", err)
+		}
+	}
+
+	readings = append(readings, fetched...)
+	sort.Slice(readings, func(i, j int) bool {
+		return readings[i].DateTime.Before(readings[j].DateTime)
+	})
+	return readings, nil
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"github.com/Stutern-128/backend/aqi"
+	"github.com/Stutern-128/backend/models"
+)
+
+// indexComputations are the extra computations for lookups that report
+// indexes: every concentration is needed to find the dominant pollutant of
+// whichever index becomes the headline.
+var indexComputations = []string{"LOCAL_AQI", "POLLUTANT_CONCENTRATION"}
+
+// selectIndexes returns the headline index and every index of a reading. The
+// headline is the preferred index when given, computed from the pollutant
+// concentrations if the provider did not return it, and otherwise the
+// provider's first index. ok is false when the reading has no index at all.
+func selectIndexes(airQuality *models.AirQuality, preferred string) (headline models.Index, indexes []models.Index, ok bool) {
+	indexes = airQuality.Indexes
+	if preferred != "" {
+		for _, index := range indexes {
+			if index.Code == preferred {
+				return index, indexes, true
+			}
+		}
+		concentrations := make(map[string]models.Concentration, len(airQuality.Pollutants))
+		for _, pollutant := range airQuality.Pollutants {
+			concentrations[pollutant.Code] = pollutant.Concentration
+		}
+		if result, err := aqi.Compute(preferred, concentrations); err == nil {
+			// Copy so the cached reading is left untouched
+			indexes = append(append([]models.Index{}, indexes...), result.Index())
+			return result.Index(), indexes, true
+		}
+	}
+	if len(indexes) == 0 {
+		return models.Index{}, nil, false
+	}
+	return indexes[0], indexes, true
+}
+
+// dominantPollutant returns the pollutant an index is dominated by, falling
+// back to the first pollutant for readings fetched with only the dominant
+// concentration.
+func dominantPollutant(airQuality *models.AirQuality, index models.Index) (models.Pollutant, bool) {
+	for _, pollutant := range airQuality.Pollutants {
+		if pollutant.Code == index.DominantPollutant {
+			return pollutant, true
+		}
+	}
+	if len(airQuality.Pollutants) == 0 {
+		return models.Pollutant{}, false
+	}
+	return airQuality.Pollutants[0], true
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"github.com/Stutern-128/backend/auth"
+	"github.com/Stutern-128/backend/store"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+	"strconv"
+)
+
+type APIKeyRequest struct {
+	Name  string `json:"name"`
+	Admin bool   `json:"admin"`
+	// RatePerMinute and DailyQuota default to the configured limits when nil
+	RatePerMinute *int `json:"ratePerMinute"`
+	DailyQuota    *int `json:"dailyQuota"`
+}
+
+func (app *App) HandleListKeys() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		keys, err := app.Store.APIKeys(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error listing API keys", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if keys == nil {
+			keys = []store.APIKey{}
+		}
+		return c.Status(fiber.StatusOK).JSON(keys)
+	}
+}
+
+// HandleIssueKey creates an API key and returns it together with the key
+// itself, which is not shown again.
+func (app *App) HandleIssueKey() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		var request APIKeyRequest
+		if err := c.BodyParser(&request); err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		if request.Name == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Name is required",
+			})
+		}
+		key := store.APIKey{
+			Name:          request.Name,
+			Admin:         request.Admin,
+			RatePerMinute: app.Config.API_KEY_RATE_PER_MINUTE,
+			DailyQuota:    app.Config.API_KEY_DAILY_QUOTA,
+		}
+		if request.RatePerMinute != nil {
+			key.RatePerMinute = *request.RatePerMinute
+		}
+		if request.DailyQuota != nil {
+			key.DailyQuota = *request.DailyQuota
+		}
+		if key.RatePerMinute < 0 || key.DailyQuota < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Limits must not be negative",
+			})
+		}
+		secret, err := auth.NewKey()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		key.Prefix, key.Hash = auth.Prefix(secret), auth.Hash(secret)
+		if err := app.Store.AddAPIKey(ctx, &key); err != nil {
+			slog.ErrorContext(ctx, "Error adding API key", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"key":    secret,
+			"apiKey": key,
+		})
+	}
+}
+
+func (app *App) HandleRevokeKey() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid key id",
+			})
+		}
+		revoked, err := app.Store.RevokeAPIKey(ctx, id)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error revoking API key", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if !revoked {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key not found",
+			})
+		}
+		if app.Limiter != nil {
+			app.Limiter.Forget(id)
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"success": true,
+		})
+	}
+}
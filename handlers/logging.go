@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"github.com/Stutern-128/backend/logging"
+	"github.com/Stutern-128/backend/metering"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"log/slog"
+	"time"
+)
+
+// requestIDHeader carries the ID of a request, taken from the client when it
+// sends one and echoed on the response.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the client request IDs that are kept.
+const maxRequestIDLength = 128
+
+// LogRequests gives every request an ID, hands it to the handlers through the
+// request's user context so that their logs carry it, and logs the request
+// with its route, status and latency once it is served. It must run after
+// TraceRequests for the logs to carry the trace ID.
+func (app *App) LogRequests() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		requestID := c.Get(requestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = utils.UUIDv4()
+		}
+		c.Set(requestIDHeader, requestID)
+		c.SetUserContext(logging.WithRequestID(c.UserContext(), requestID))
+
+		err := c.Next()
+		route, status := requestOutcome(c, err)
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		// The user context is read again for the client authentication set
+		ctx := c.UserContext()
+		slog.LogAttrs(ctx, level, "Request",
+			slog.String("method", c.Method()),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client", metering.Client(ctx)),
+		)
+		return err
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/Stutern-128/backend/metrics"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"strconv"
+	"time"
+)
+
+// unmatchedRoute labels requests no route matched, so that arbitrary paths
+// don't each get their own series.
+const unmatchedRoute = "unmatched"
+
+// InstrumentRequests counts and times requests per route and tracks the
+// requests being served. It must run before the other middleware so that
+// rejected requests are counted too.
+func (app *App) InstrumentRequests() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		metrics.InFlight.Inc()
+		defer metrics.InFlight.Dec()
+		start := time.Now()
+		err := c.Next()
+
+		route, status := requestOutcome(c, err)
+		metrics.Requests.WithLabelValues(c.Method(), route, strconv.Itoa(status)).Inc()
+		metrics.RequestDuration.WithLabelValues(c.Method(), route).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// requestOutcome returns the route a request matched and the status it is
+// answered with once the handlers returned err.
+func requestOutcome(c *fiber.Ctx, err error) (string, int) {
+	route, status := c.Route().Path, c.Response().StatusCode()
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+		if status == fiber.StatusNotFound {
+			route = unmatchedRoute
+		}
+	} else if err != nil {
+		status = fiber.StatusInternalServerError
+	}
+	return route, status
+}
+
+// HandleMetrics serves the metrics in the Prometheus text format.
+func (app *App) HandleMetrics() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"github.com/Stutern-128/backend/geo"
+	"github.com/Stutern-128/backend/logging"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/gofiber/fiber/v2"
+	"googlemaps.github.io/maps"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	defaultNearbyRadius = 5000
+	// maxNearbyRadius is the largest radius the Places API accepts.
+	maxNearbyRadius    = 50000
+	defaultNearbyLimit = 10
+	maxNearbyLimit     = 20
+)
+
+// nearbyPlace is a place found around the requested location with its
+// current conditions.
+type nearbyPlace struct {
+	result   maps.PlacesSearchResult
+	distance float64
+	response fiber.Map
+	index    models.Index
+}
+
+// HandleNearByPlaces ranks the nearest places around a location from the
+// cleanest air to the most polluted, optionally limited to some place types.
+func (app *App) HandleNearByPlaces() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		var request LocationRequest
+		if err := c.BodyParser(&request); err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		if request.hasCoordinates() {
+			if !validCoordinates(request.Latitude, request.Longitude) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"error":   "Invalid latitude or longitude",
+				})
+			}
+			if _, err := app.resolveLocation(ctx, request.Latitude, request.Longitude); err != nil {
+				return c.Status(locationStatus(err)).JSON(fiber.Map{
+					"success": false,
+					"error":   err.Error(),
+				})
+			}
+		}
+		request.initializeDefaults(app.Config)
+		if request.Radius <= 0 {
+			request.Radius = defaultNearbyRadius
+		}
+		if request.Radius > maxNearbyRadius {
+			request.Radius = maxNearbyRadius
+		}
+		if request.Limit <= 0 {
+			request.Limit = defaultNearbyLimit
+		}
+		if request.Limit > maxNearbyLimit {
+			request.Limit = maxNearbyLimit
+		}
+		// An empty type searches every kind of place
+		placeTypes := []maps.PlaceType{""}
+		if len(request.Types) > 0 {
+			placeTypes = nil
+			for _, name := range request.Types {
+				placeType, err := maps.ParsePlaceType(name)
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"success": false,
+						"error":   "Unknown place type " + name,
+					})
+				}
+				placeTypes = append(placeTypes, placeType)
+			}
+		}
+
+		results, err := app.searchNearby(ctx, request, placeTypes)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error searching nearby places", "error", err)
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "Can't resolve nearby places",
+			})
+		}
+
+		// Only the nearest places get an air quality lookup
+		distances := make(map[string]float64, len(results))
+		for _, result := range results {
+			location := result.Geometry.Location
+			distances[result.PlaceID] = geo.Distance(request.Latitude, request.Longitude, location.Lat, location.Lng)
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return distances[results[i].PlaceID] < distances[results[j].PlaceID]
+		})
+		if len(results) > request.Limit {
+			results = results[:request.Limit]
+		}
+
+		places := make([]*nearbyPlace, len(results))
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, lookupConcurrency)
+		for i, result := range results {
+			wg.Add(1)
+			go func(i int, result maps.PlacesSearchResult) {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				location := result.Geometry.Location
+				airQuality, err := app.AirQuality.CurrentConditions(ctx, providers.Request{
+					Latitude:          location.Lat,
+					Longitude:         location.Lng,
+					ExtraComputations: indexComputations,
+				})
+				if err != nil {
+					slog.ErrorContext(ctx, "Error fetching current conditions", logging.Cell(location.Lat, location.Lng), "error", err)
+					return
+				}
+				response, ok := aqiResponse(airQuality, result.FormattedAddress, request.PreferredIndex)
+				if !ok {
+					return
+				}
+				index, _, _ := selectIndexes(airQuality, request.PreferredIndex)
+				places[i] = &nearbyPlace{
+					result:   result,
+					distance: distances[result.PlaceID],
+					response: response,
+					index:    index,
+				}
+			}(i, result)
+		}
+		wg.Wait()
+
+		// AQI values only compare within one index, so places reporting
+		// another index than the nearest one follow by distance
+		ranked := places[:0]
+		for _, place := range places {
+			if place != nil {
+				ranked = append(ranked, place)
+			}
+		}
+		var code string
+		if len(ranked) > 0 {
+			code = ranked[0].index.Code
+		}
+		sort.SliceStable(ranked, func(i, j int) bool {
+			a, b := ranked[i], ranked[j]
+			if (a.index.Code == code) != (b.index.Code == code) {
+				return a.index.Code == code
+			}
+			if a.index.Code == code && a.index.Aqi != b.index.Aqi {
+				return cleaner(a.index, b.index)
+			}
+			return a.distance < b.distance
+		})
+
+		aqiValues := make([]interface{}, 0, len(ranked))
+		for _, place := range ranked {
+			if place.response["location"] == "" {
+				place.response["location"] = place.result.Vicinity
+			}
+			place.response["Name"] = place.result.Name
+			place.response["Vicinity"] = place.result.Vicinity
+			place.response["placeId"] = place.result.PlaceID
+			place.response["types"] = place.result.Types
+			place.response["latitude"] = place.result.Geometry.Location.Lat
+			place.response["longitude"] = place.result.Geometry.Location.Lng
+			place.response["distanceMeters"] = math.Round(place.distance)
+			aqiValues = append(aqiValues, place.response)
+		}
+		return c.Status(fiber.StatusOK).JSON(aqiValues)
+	}
+}
+
+// searchNearby runs a nearby search per place type and merges the first
+// result page of each, which holds up to 20 places.
+func (app *App) searchNearby(ctx context.Context, request LocationRequest, placeTypes []maps.PlaceType) ([]maps.PlacesSearchResult, error) {
+	var results []maps.PlacesSearchResult
+	seen := make(map[string]bool)
+	for _, placeType := range placeTypes {
+		response, err := app.MapsClient.NearbySearch(ctx, &maps.NearbySearchRequest{
+			Location: &maps.LatLng{Lat: request.Latitude, Lng: request.Longitude},
+			Radius:   uint(request.Radius),
+			Type:     placeType,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range response.Results {
+			if !seen[result.PlaceID] {
+				seen[result.PlaceID] = true
+				results = append(results, result)
+			}
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Stutern-128/backend/cache"
+	"github.com/Stutern-128/backend/conf"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/gofiber/fiber/v2"
+	"googlemaps.github.io/maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// nearbyMaps finds the same places, farthest first, around every location.
+type nearbyMaps struct {
+	fakeMaps
+	places []maps.PlacesSearchResult
+}
+
+func (m *nearbyMaps) NearbySearch(ctx context.Context, r *maps.NearbySearchRequest) (maps.PlacesSearchResponse, error) {
+	return maps.PlacesSearchResponse{Results: m.places}, nil
+}
+
+// indexProvider reports the index set for a latitude and records the
+// latitudes it was asked for.
+type indexProvider struct {
+	providers.AirQualityProvider
+	indexes   map[float64]models.Index
+	mu        sync.Mutex
+	latitudes []float64
+}
+
+func (p *indexProvider) Supports(countryCode string) bool {
+	return countryCode == "AU"
+}
+
+func (p *indexProvider) CurrentConditions(ctx context.Context, request providers.Request) (*models.AirQuality, error) {
+	p.mu.Lock()
+	p.latitudes = append(p.latitudes, request.Latitude)
+	p.mu.Unlock()
+	index := p.indexes[request.Latitude]
+	index.DominantPollutant = "pm25"
+	return &models.AirQuality{
+		DateTime:   time.Now(),
+		Indexes:    []models.Index{index},
+		Pollutants: []models.Pollutant{{Code: "pm25"}},
+	}, nil
+}
+
+func place(id string, latitude float64) maps.PlacesSearchResult {
+	result := maps.PlacesSearchResult{PlaceID: id, Name: id}
+	result.Geometry.Location = maps.LatLng{Lat: latitude, Lng: 151.21}
+	return result
+}
+
+func newNearbyApp(countryCode string) (*fiber.App, *indexProvider) {
+	provider := &indexProvider{indexes: map[float64]models.Index{
+		-33.871: {Code: "usa_epa", Aqi: 80},
+		-33.872: {Code: "usa_epa", Aqi: 30},
+		-33.873: {Code: "uaqi", Aqi: 90},
+		-33.874: {Code: "usa_epa", Aqi: 10},
+	}}
+	app := &App{
+		MapsClient: &nearbyMaps{
+			fakeMaps: fakeMaps{countryCode: countryCode},
+			places:   []maps.PlacesSearchResult{place("d", -33.874), place("c", -33.873), place("b", -33.872), place("a", -33.871)},
+		},
+		AirQuality:   provider,
+		GeocodeCache: cache.New[maps.GeocodingResult](time.Hour, 100),
+		Config:       &conf.Configuration{CACHE_GEOHASH_PRECISION: 6},
+	}
+	server := fiber.New()
+	server.Post("/nearby", app.HandleNearByPlaces())
+	return server, provider
+}
+
+func postNearby(t *testing.T, server *fiber.App, body string) (int, []byte) {
+	request := httptest.NewRequest(http.MethodPost, "/nearby", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	response, err := server.Test(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw json.RawMessage
+	if err := json.NewDecoder(response.Body).Decode(&raw); err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, raw
+}
+
+func TestHandleNearByPlacesRanksNearestWithinOneIndex(t *testing.T) {
+	server, provider := newNearbyApp("AU")
+
+	status, body := postNearby(t, server, `{"latitude": -33.87, "longitude": 151.21, "limit": 3}`)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", status, body)
+	}
+	var places []map[string]interface{}
+	if err := json.Unmarshal(body, &places); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, place := range places {
+		names = append(names, place["Name"].(string))
+	}
+	// The farthest place is left out before its lookup, and the place with
+	// another index follows the ones that compare
+	if got := strings.Join(names, ","); got != "b,a,c" {
+		t.Errorf("places = %s, want b,a,c", got)
+	}
+	if len(provider.latitudes) != 3 {
+		t.Errorf("made %d lookups, want 3", len(provider.latitudes))
+	}
+}
+
+func TestHandleNearByPlacesChecksCountry(t *testing.T) {
+	server, provider := newNearbyApp("NZ")
+
+	status, body := postNearby(t, server, `{"latitude": -33.87, "longitude": 151.21}`)
+	if status != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 for an unsupported country: %s", status, body)
+	}
+	if len(provider.latitudes) != 0 {
+		t.Errorf("made %d lookups, want 0", len(provider.latitudes))
+	}
+}
+
+func TestHandleNearByPlacesRejectsInvalidCoordinates(t *testing.T) {
+	server, _ := newNearbyApp("AU")
+
+	status, body := postNearby(t, server, `{"latitude": -95, "longitude": 151.21}`)
+	if status != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400: %s", status, body)
+	}
+}
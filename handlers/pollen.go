@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/Stutern-128/backend/logging"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+)
+
+// HandlePollen returns the daily grass, tree and weed pollen forecast for a
+// location, with the individual plants of each day.
+func (app *App) HandlePollen() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		var request LocationRequest
+		if err := c.BodyParser(&request); err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		var address string
+		if request.Latitude == 0 || request.Longitude == 0 {
+			request.initializeDefaults(app.Config)
+			address = "CW98+VV Mountain View, CA, USA"
+		} else {
+			var err error
+			address, err = app.resolveLocationFor(ctx, request.Latitude, request.Longitude, app.Pollen.Supports)
+			if err != nil {
+				return c.Status(locationStatus(err)).JSON(fiber.Map{
+					"success": false,
+					"error":   err.Error(),
+				})
+			}
+		}
+
+		forecast, err := app.Pollen.Forecast(ctx, providers.PollenRequest{
+			Latitude:          request.Latitude,
+			Longitude:         request.Longitude,
+			Days:              request.Days,
+			PlantsDescription: true,
+		})
+		var upstreamErr *providers.UpstreamError
+		if errors.As(err, &upstreamErr) && upstreamErr.StatusCode == fiber.StatusBadRequest {
+			// The Pollen API rejects locations it has no coverage for
+			slog.InfoContext(ctx, "Unsupported pollen location", logging.Cell(request.Latitude, request.Longitude), "error", err)
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   errLocationNotSupported.Error(),
+			})
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Error fetching pollen forecast", logging.Cell(request.Latitude, request.Longitude), "error", err)
+			return c.Status(upstreamStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+
+		var days []interface{}
+		for _, day := range forecast.DailyInfo {
+			days = append(days, fiber.Map{
+				"date":   day.Date.String(),
+				"grass":  day.Grass(),
+				"tree":   day.Tree(),
+				"weed":   day.Weed(),
+				"plants": day.PlantInfo,
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"location":   address,
+			"regionCode": forecast.RegionCode,
+			"days":       days,
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Stutern-128/backend/cache"
+	"github.com/Stutern-128/backend/conf"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/gofiber/fiber/v2"
+	"googlemaps.github.io/maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeMaps reverse geocodes every location to countryCode.
+type fakeMaps struct {
+	MapsAPI
+	countryCode string
+}
+
+func (m *fakeMaps) ReverseGeocode(ctx context.Context, r *maps.GeocodingRequest) ([]maps.GeocodingResult, error) {
+	return []maps.GeocodingResult{{
+		FormattedAddress: "Somewhere, " + m.countryCode,
+		AddressComponents: []maps.AddressComponent{
+			{ShortName: m.countryCode, Types: []string{"country", "political"}},
+		},
+	}}, nil
+}
+
+// newPollenApp returns an app whose pollen upstream serves the recorded
+// responses of the providers tests, with status and the fixture name, and
+// counts the calls made to it.
+func newPollenApp(t *testing.T, countryCode string, status int, fixture string) (*fiber.App, *atomic.Int32) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, err := os.ReadFile(filepath.Join("..", "providers", "testdata", "pollen", fixture))
+		if err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(upstream.Close)
+
+	app := &App{
+		MapsClient:   &fakeMaps{countryCode: countryCode},
+		Pollen:       providers.NewGooglePollen(upstream.URL+"/v1/", "test-key", []string{"US", "FR"}),
+		GeocodeCache: cache.New[maps.GeocodingResult](time.Hour, 100),
+		Config:       &conf.Configuration{CACHE_GEOHASH_PRECISION: 6},
+	}
+	server := fiber.New()
+	server.Post("/pollen", app.HandlePollen())
+	return server, &calls
+}
+
+func postPollen(t *testing.T, server *fiber.App) (int, map[string]interface{}) {
+	request := httptest.NewRequest(http.MethodPost, "/pollen",
+		strings.NewReader(`{"latitude": 37.4197, "longitude": -122.0827, "days": 2}`))
+	request.Header.Set("Content-Type", "application/json")
+	response, err := server.Test(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, body
+}
+
+func TestHandlePollenSupportedRegion(t *testing.T) {
+	server, calls := newPollenApp(t, "US", http.StatusOK, "forecast.json")
+
+	status, body := postPollen(t, server)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %v", status, body)
+	}
+	if body["location"] != "Somewhere, US" || body["regionCode"] != "US" {
+		t.Errorf("location = %v, regionCode = %v", body["location"], body["regionCode"])
+	}
+	days, _ := body["days"].([]interface{})
+	if len(days) != 2 {
+		t.Fatalf("got %d days, want 2", len(days))
+	}
+	today := days[0].(map[string]interface{})
+	if today["date"] != "2024-04-22" {
+		t.Errorf("date = %v, want 2024-04-22", today["date"])
+	}
+	for pollen, want := range map[string]float64{"grass": 2, "tree": 4, "weed": 0} {
+		info, _ := today[pollen].(map[string]interface{})
+		index, _ := info["indexInfo"].(map[string]interface{})
+		if index["value"] != want {
+			t.Errorf("%s = %v, want %v", pollen, index["value"], want)
+		}
+	}
+	if plants, _ := today["plants"].([]interface{}); len(plants) != 3 {
+		t.Errorf("got %d plants, want 3", len(plants))
+	}
+	// Tomorrow has no weed reading
+	if tomorrow := days[1].(map[string]interface{}); tomorrow["weed"] != nil {
+		t.Errorf("tomorrow's weed = %v, want null", tomorrow["weed"])
+	}
+	if calls.Load() != 1 {
+		t.Errorf("made %d upstream calls, want 1", calls.Load())
+	}
+}
+
+func TestHandlePollenUnsupportedRegion(t *testing.T) {
+	server, calls := newPollenApp(t, "CN", http.StatusOK, "forecast.json")
+
+	status, body := postPollen(t, server)
+	if status != http.StatusNotFound || body["error"] != errLocationNotSupported.Error() {
+		t.Errorf("status = %d, body = %v, want 404 location not supported", status, body)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("made %d upstream calls for an unsupported country, want 0", calls.Load())
+	}
+}
+
+func TestHandlePollenUpstreamRejectsLocation(t *testing.T) {
+	server, _ := newPollenApp(t, "US", http.StatusBadRequest, "unsupported.json")
+
+	status, body := postPollen(t, server)
+	if status != http.StatusNotFound || body["error"] != errLocationNotSupported.Error() {
+		t.Errorf("status = %d, body = %v, want 404 location not supported", status, body)
+	}
+}
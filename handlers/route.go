@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/Stutern-128/backend/geo"
+	"github.com/Stutern-128/backend/logging"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/gofiber/fiber/v2"
+	"googlemaps.github.io/maps"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// routeSampleMeters is the distance between AQI samples along a route.
+	routeSampleMeters = 500
+	// maxRouteSamples caps the lookups per route; longer routes are sampled
+	// further apart.
+	maxRouteSamples = 60
+)
+
+// travelSpeeds are the average speeds in meters per second assumed for
+// encoded polylines, which come without travel times.
+var travelSpeeds = map[maps.Mode]float64{
+	maps.TravelModeWalking:   5 / 3.6,
+	maps.TravelModeBicycling: 15 / 3.6,
+	maps.TravelModeTransit:   25 / 3.6,
+	maps.TravelModeDriving:   40 / 3.6,
+}
+
+type RouteRequest struct {
+	// Origin and Destination are addresses or "latitude,longitude" pairs
+	Origin      string `json:"origin"`
+	Destination string `json:"destination"`
+	// Polyline is an encoded polyline used instead of asking for directions
+	Polyline       string `json:"polyline"`
+	Mode           string `json:"mode"`
+	PreferredIndex string `json:"preferredIndex"`
+}
+
+// HandleRoute estimates the exposure along a route. It samples the AQI every
+// routeSampleMeters and weights each sample by the time spent on its segment.
+func (app *App) HandleRoute() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		var request RouteRequest
+		if err := c.BodyParser(&request); err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		mode := maps.Mode(request.Mode)
+		if mode == "" {
+			mode = maps.TravelModeDriving
+		}
+		if _, ok := travelSpeeds[mode]; !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Unknown travel mode",
+			})
+		}
+		if request.Polyline == "" && (request.Origin == "" || request.Destination == "") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Origin and destination or a polyline are required",
+			})
+		}
+
+		path, err := app.routePath(ctx, request, mode)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error resolving route", "error", err)
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "Can't resolve route",
+			})
+		}
+		length := geo.Length(path)
+		spacing := math.Max(routeSampleMeters, length/maxRouteSamples)
+		segments := geo.Split(path, spacing)
+
+		// Nearby samples share a geohash cell and so a cached lookup
+		readings := make([]*models.AirQuality, len(segments))
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, lookupConcurrency)
+		for i, segment := range segments {
+			wg.Add(1)
+			go func(i int, point geo.TimedPoint) {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				airQuality, err := app.AirQuality.CurrentConditions(ctx, providers.Request{
+					Latitude:          point.Latitude,
+					Longitude:         point.Longitude,
+					ExtraComputations: indexComputations,
+				})
+				if err != nil {
+					slog.ErrorContext(ctx, "Error fetching current conditions", logging.Cell(point.Latitude, point.Longitude), "error", err)
+					return
+				}
+				readings[i] = airQuality
+			}(i, segment.Middle)
+		}
+		wg.Wait()
+
+		var results []interface{}
+		var aqiCode string
+		var maxAqi, worstAqi int
+		var weightedAqi, weightedSeconds float64
+		for i, segment := range segments {
+			result := fiber.Map{
+				"startLatitude":   segment.Start.Latitude,
+				"startLongitude":  segment.Start.Longitude,
+				"endLatitude":     segment.End.Latitude,
+				"endLongitude":    segment.End.Longitude,
+				"distanceMeters":  math.Round(segment.Meters),
+				"durationSeconds": math.Round(segment.Duration().Seconds()),
+			}
+			results = append(results, result)
+			if readings[i] == nil {
+				continue
+			}
+			index, _, ok := selectIndexes(readings[i], request.PreferredIndex)
+			if !ok || (aqiCode != "" && index.Code != aqiCode) {
+				// Samples across a border may only share the universal index
+				continue
+			}
+			result["aqiCode"] = index.Code
+			result["aqiValue"] = index.Aqi
+			result["aqiCategory"] = index.Category
+			result["aqiColor"] = index.Color
+			result["dominantPollutantCode"] = index.DominantPollutant
+			if aqiCode == "" {
+				aqiCode, maxAqi, worstAqi = index.Code, index.Aqi, index.Aqi
+			}
+			if index.Aqi > maxAqi {
+				maxAqi = index.Aqi
+			}
+			worse := index.Aqi > worstAqi
+			if index.HigherIsBetter() {
+				worse = index.Aqi < worstAqi
+			}
+			if worse {
+				worstAqi = index.Aqi
+			}
+			seconds := math.Max(segment.Duration().Seconds(), 1)
+			weightedAqi += float64(index.Aqi) * seconds
+			weightedSeconds += seconds
+		}
+		if aqiCode == "" {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"success": false,
+				"error":   "No air quality available along the route",
+			})
+		}
+		var duration time.Duration
+		if len(path) > 0 {
+			duration = path[len(path)-1].Elapsed
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"mode":            mode,
+			"distanceMeters":  math.Round(length),
+			"durationSeconds": math.Round(duration.Seconds()),
+			"aqiCode":         aqiCode,
+			"maxAqi":          maxAqi,
+			"worstAqi":        worstAqi,
+			"averageAqi":      math.Round(weightedAqi/weightedSeconds*10) / 10,
+			"segments":        results,
+		})
+	}
+}
+
+// routePath returns the points of a route with the time each is passed,
+// taking travel times from the Directions API or assuming an average speed
+// for encoded polylines.
+func (app *App) routePath(ctx context.Context, request RouteRequest, mode maps.Mode) ([]geo.TimedPoint, error) {
+	if request.Polyline != "" {
+		points, err := maps.DecodePolyline(request.Polyline)
+		if err != nil {
+			return nil, err
+		}
+		if len(points) < 2 {
+			return nil, errors.New("polyline has fewer than two points")
+		}
+		path := []geo.TimedPoint{{Latitude: points[0].Lat, Longitude: points[0].Lng}}
+		var meters float64
+		for i := 1; i < len(points); i++ {
+			meters += geo.Distance(points[i-1].Lat, points[i-1].Lng, points[i].Lat, points[i].Lng)
+			path = append(path, geo.TimedPoint{
+				Latitude:  points[i].Lat,
+				Longitude: points[i].Lng,
+				Elapsed:   time.Duration(meters / travelSpeeds[mode] * float64(time.Second)),
+			})
+		}
+		return path, nil
+	}
+
+	routes, _, err := app.MapsClient.Directions(ctx, &maps.DirectionsRequest{
+		Origin:      request.Origin,
+		Destination: request.Destination,
+		Mode:        mode,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 {
+		return nil, errLocationNotFound
+	}
+	// Spread each step's travel time over its points by distance
+	var path []geo.TimedPoint
+	var elapsed time.Duration
+	for _, leg := range routes[0].Legs {
+		for _, step := range leg.Steps {
+			points, err := step.Polyline.Decode()
+			if err != nil {
+				return nil, err
+			}
+			stepPath := make([]geo.TimedPoint, len(points))
+			for i, point := range points {
+				stepPath[i] = geo.TimedPoint{Latitude: point.Lat, Longitude: point.Lng}
+			}
+			stepLength := geo.Length(stepPath)
+			var meters float64
+			for i := range stepPath {
+				if i > 0 {
+					meters += geo.Distance(stepPath[i-1].Latitude, stepPath[i-1].Longitude, stepPath[i].Latitude, stepPath[i].Longitude)
+				}
+				if stepLength > 0 {
+					stepPath[i].Elapsed = elapsed + time.Duration(float64(step.Duration)*meters/stepLength)
+				} else {
+					stepPath[i].Elapsed = elapsed
+				}
+			}
+			if len(path) > 0 && len(stepPath) > 0 {
+				// Steps start where the previous one ended
+				stepPath = stepPath[1:]
+			}
+			path = append(path, stepPath...)
+			elapsed += step.Duration
+		}
+	}
+	if len(path) < 2 {
+		return nil, errLocationNotFound
+	}
+	return path, nil
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Stutern-128/backend/logging"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/Stutern-128/backend/store"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type SavedLocationRequest struct {
+	Name           string  `json:"name"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	TimeZone       string  `json:"timeZone"`
+	PreferredIndex string  `json:"preferredIndex"`
+}
+
+func (r *SavedLocationRequest) validate() string {
+	if r.Name == "" {
+		return "Name is required"
+	}
+	if r.Latitude == 0 || r.Longitude == 0 {
+		return "Latitude and longitude are required"
+	}
+	if _, err := time.LoadLocation(r.TimeZone); err != nil {
+		return "Unknown time zone"
+	}
+	return ""
+}
+
+func (app *App) HandleListSavedLocations() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		locations, err := app.Store.SavedLocations(ctx, userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error listing saved locations", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if locations == nil {
+			locations = []store.SavedLocation{}
+		}
+		return c.Status(fiber.StatusOK).JSON(locations)
+	}
+}
+
+// HandleCreateSavedLocation saves a location for the caller. The location
+// must pass the same geocoding and coverage checks as a lookup.
+func (app *App) HandleCreateSavedLocation() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		var request SavedLocationRequest
+		if err := c.BodyParser(&request); err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		if message := request.validate(); message != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   message,
+			})
+		}
+		if _, err := app.resolveLocation(ctx, request.Latitude, request.Longitude); err != nil {
+			return c.Status(locationStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		location := store.SavedLocation{
+			UserID:         userID,
+			Name:           request.Name,
+			Latitude:       request.Latitude,
+			Longitude:      request.Longitude,
+			TimeZone:       request.TimeZone,
+			PreferredIndex: request.PreferredIndex,
+		}
+		err := app.Store.AddSavedLocation(ctx, &location)
+		if errors.Is(err, store.ErrTooManySavedLocations) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"error":   fmt.Sprintf("At most %d locations can be saved", store.MaxSavedLocations),
+			})
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Error adding saved location", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusCreated).JSON(location)
+	}
+}
+
+func (app *App) HandleGetSavedLocation() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid location id",
+			})
+		}
+		location, err := app.Store.SavedLocation(ctx, userID, id)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error loading saved location", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if location == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "Saved location not found",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(location)
+	}
+}
+
+func (app *App) HandleUpdateSavedLocation() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid location id",
+			})
+		}
+		var request SavedLocationRequest
+		if err := c.BodyParser(&request); err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		if message := request.validate(); message != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   message,
+			})
+		}
+		if _, err := app.resolveLocation(ctx, request.Latitude, request.Longitude); err != nil {
+			return c.Status(locationStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		location := store.SavedLocation{
+			ID:             id,
+			UserID:         userID,
+			Name:           request.Name,
+			Latitude:       request.Latitude,
+			Longitude:      request.Longitude,
+			TimeZone:       request.TimeZone,
+			PreferredIndex: request.PreferredIndex,
+		}
+		updated, err := app.Store.UpdateSavedLocation(ctx, &location)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error updating saved location", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if !updated {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "Saved location not found",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"success": true,
+		})
+	}
+}
+
+func (app *App) HandleDeleteSavedLocation() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid location id",
+			})
+		}
+		removed, err := app.Store.RemoveSavedLocation(ctx, userID, id)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error removing saved location", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if !removed {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "Saved location not found",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"success": true,
+		})
+	}
+}
+
+// HandleDashboard returns the current conditions of every saved location of
+// the caller, each in its own time zone and preferred index. Locations whose
+// lookup fails carry an error instead.
+func (app *App) HandleDashboard() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		locations, err := app.Store.SavedLocations(ctx, userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error listing saved locations", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+
+		// Rows saved before the cap was enforced aren't looked up
+		if len(locations) > store.MaxSavedLocations {
+			locations = locations[:store.MaxSavedLocations]
+		}
+
+		entries := make([]interface{}, len(locations))
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, lookupConcurrency)
+		for i, location := range locations {
+			wg.Add(1)
+			go func(i int, location store.SavedLocation) {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				entry := fiber.Map{
+					"id":             location.ID,
+					"name":           location.Name,
+					"latitude":       location.Latitude,
+					"longitude":      location.Longitude,
+					"timeZone":       location.TimeZone,
+					"preferredIndex": location.PreferredIndex,
+				}
+				entries[i] = entry
+				address, err := app.resolveLocation(ctx, location.Latitude, location.Longitude)
+				if err != nil {
+					entry["error"] = err.Error()
+					return
+				}
+				airQuality, err := app.AirQuality.CurrentConditions(ctx, providers.Request{
+					Latitude:          location.Latitude,
+					Longitude:         location.Longitude,
+					ExtraComputations: indexComputations,
+				})
+				if err != nil {
+					slog.ErrorContext(ctx, "Error fetching current conditions", logging.Cell(location.Latitude, location.Longitude), "error", err)
+					entry["error"] = err.Error()
+					return
+				}
+				response, ok := aqiResponse(airQuality, address, location.PreferredIndex)
+				if !ok {
+					entry["error"] = "No air quality index available"
+					return
+				}
+				timeZone, _ := time.LoadLocation(location.TimeZone)
+				response["dateTime"] = airQuality.DateTime.In(timeZone)
+				for key, value := range response {
+					if _, set := entry[key]; !set {
+						entry[key] = value
+					}
+				}
+			}(i, location)
+		}
+		wg.Wait()
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"locations": entries,
+		})
+	}
+}
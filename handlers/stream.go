@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"log/slog"
+	"time"
+)
+
+// HandleStreamAQI streams the /aqi response for a location as Server-Sent
+// Events, sending a new event whenever the hourly reading changes and a
+// comment line as heartbeat in between.
+func (app *App) HandleStreamAQI() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		latitude, longitude := c.QueryFloat("latitude"), c.QueryFloat("longitude")
+		preferredIndex := c.Query("preferredIndex")
+		if latitude == 0 || longitude == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Latitude and longitude are required",
+			})
+		}
+		address, err := app.resolveLocation(ctx, latitude, longitude)
+		if err != nil {
+			return c.Status(locationStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		c.Set(fiber.HeaderConnection, "keep-alive")
+		c.Set("X-Accel-Buffering", "no")
+		heartbeat := time.Duration(app.Config.STREAM_HEARTBEAT_SECONDS) * time.Second
+		if heartbeat <= 0 {
+			heartbeat = 15 * time.Second
+		}
+
+		c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+			// The writer outlives the handler; a failed flush is the only sign
+			// that the client has gone away.
+			updates, unsubscribe := app.Streams.Subscribe(latitude, longitude)
+			defer unsubscribe()
+			ticker := time.NewTicker(heartbeat)
+			defer ticker.Stop()
+
+			fmt.Fprintf(w, "retry: %d\n\n", heartbeat.Milliseconds())
+			if err := w.Flush(); err != nil {
+				return
+			}
+			for {
+				select {
+				case airQuality := <-updates:
+					response, ok := aqiResponse(airQuality, address, preferredIndex)
+					if !ok {
+						continue
+					}
+					data, err := json.Marshal(response)
+					if err != nil {
+						slog.ErrorContext(ctx, "Error encoding stream event", "error", err)
+						continue
+					}
+					fmt.Fprintf(w, "event: aqi\nid: %d\ndata: %s\n\n", airQuality.DateTime.Unix(), data)
+				case <-ticker.C:
+					fmt.Fprint(w, ": heartbeat\n\n")
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}))
+		return nil
+	}
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"github.com/Stutern-128/backend/alerts"
+	"github.com/Stutern-128/backend/logging"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/Stutern-128/backend/store"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+	"strconv"
+)
+
+type SubscriptionRequest struct {
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	Threshold  int     `json:"threshold"`
+	Category   string  `json:"category"`
+	WebhookURL string  `json:"webhookUrl"`
+}
+
+func (r *SubscriptionRequest) validate() string {
+	if r.Latitude == 0 || r.Longitude == 0 {
+		return "Latitude and longitude are required"
+	}
+	if r.Threshold < 0 {
+		return "Threshold must not be negative"
+	}
+	if r.Category != "" && !models.IsCategory(r.Category) {
+		return "Unknown category"
+	}
+	if err := alerts.CheckURL(r.WebhookURL); err != nil {
+		return "Invalid webhook URL: " + err.Error()
+	}
+	return ""
+}
+
+// hasCategoryIndex reports whether an index available at the requested
+// location has the requested category, so that the subscription can fire.
+func (app *App) hasCategoryIndex(ctx context.Context, r *SubscriptionRequest) (bool, error) {
+	if r.Category == "" {
+		return true, nil
+	}
+	airQuality, err := app.AirQuality.CurrentConditions(ctx, providers.Request{
+		Latitude:          r.Latitude,
+		Longitude:         r.Longitude,
+		ExtraComputations: alerts.Computations,
+	})
+	if err != nil {
+		return false, err
+	}
+	_, ok := alerts.SelectIndex(store.Subscription{Category: r.Category}, airQuality.Indexes)
+	return ok, nil
+}
+
+func (app *App) HandleListSubscriptions() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		subscriptions, err := app.Store.UserSubscriptions(ctx, userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error listing subscriptions", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if subscriptions == nil {
+			subscriptions = []store.Subscription{}
+		}
+		for i := range subscriptions {
+			subscriptions[i].Secret = ""
+		}
+		return c.Status(fiber.StatusOK).JSON(subscriptions)
+	}
+}
+
+// HandleCreateSubscription stores a subscription and returns it together
+// with the webhook signing secret, which is not shown again.
+func (app *App) HandleCreateSubscription() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		var request SubscriptionRequest
+		if err := c.BodyParser(&request); err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		if message := request.validate(); message != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   message,
+			})
+		}
+		ok, err := app.hasCategoryIndex(ctx, &request)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error fetching current conditions", logging.Cell(request.Latitude, request.Longitude), "error", err)
+			return c.Status(upstreamStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Category does not belong to an index available at the location",
+			})
+		}
+		secret, err := alerts.NewSecret()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		subscription := store.Subscription{
+			UserID:     userID,
+			Latitude:   request.Latitude,
+			Longitude:  request.Longitude,
+			Threshold:  request.Threshold,
+			Category:   request.Category,
+			WebhookURL: request.WebhookURL,
+			Secret:     secret,
+		}
+		if err := app.Store.AddSubscription(ctx, &subscription); err != nil {
+			slog.ErrorContext(ctx, "Error adding subscription", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusCreated).JSON(subscription)
+	}
+}
+
+func (app *App) HandleGetSubscription() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid subscription id",
+			})
+		}
+		subscription, err := app.Store.Subscription(ctx, userID, id)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error loading subscription", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if subscription == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "Subscription not found",
+			})
+		}
+		subscription.Secret = ""
+		return c.Status(fiber.StatusOK).JSON(subscription)
+	}
+}
+
+// HandleUpdateSubscription replaces a subscription's location, threshold and
+// webhook. The signing secret is kept.
+func (app *App) HandleUpdateSubscription() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid subscription id",
+			})
+		}
+		var request SubscriptionRequest
+		if err := c.BodyParser(&request); err != nil {
+			slog.WarnContext(ctx, "Invalid request payload", "error", err)
+		}
+		if message := request.validate(); message != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   message,
+			})
+		}
+		ok, err := app.hasCategoryIndex(ctx, &request)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error fetching current conditions", logging.Cell(request.Latitude, request.Longitude), "error", err)
+			return c.Status(upstreamStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Category does not belong to an index available at the location",
+			})
+		}
+		subscription := store.Subscription{
+			ID:         id,
+			UserID:     userID,
+			Latitude:   request.Latitude,
+			Longitude:  request.Longitude,
+			Threshold:  request.Threshold,
+			Category:   request.Category,
+			WebhookURL: request.WebhookURL,
+		}
+		updated, err := app.Store.UpdateSubscription(ctx, &subscription)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error updating subscription", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if !updated {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "Subscription not found",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"success": true,
+		})
+	}
+}
+
+func (app *App) HandleDeleteSubscription() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		userID := app.userID(c)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key required",
+			})
+		}
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid subscription id",
+			})
+		}
+		removed, err := app.Store.RemoveSubscription(ctx, userID, id)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error removing subscription", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		if !removed {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "Subscription not found",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"success": true,
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Stutern-128/backend/metering"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// HandleHeatmapTile proxies Air Quality API heatmap tiles so the API key stays
+// on the server. Tiles are kept on disk until the hour they were fetched in
+// is over, since the heatmaps are refreshed hourly.
+func (app *App) HandleHeatmapTile() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		mapType := c.Params("mapType")
+		if !providers.IsHeatmapType(mapType) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Unknown map type",
+			})
+		}
+		z, errZ := strconv.Atoi(c.Params("z"))
+		x, errX := strconv.Atoi(c.Params("x"))
+		y, errY := strconv.Atoi(c.Params("y"))
+		if errZ != nil || errX != nil || errY != nil || z < 0 || z > providers.MaxTileZoom ||
+			x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid tile coordinates",
+			})
+		}
+
+		now := time.Now()
+		hour := now.Truncate(time.Hour)
+		key := fmt.Sprintf("%s/%d/%d/%d.png", mapType, z, x, y)
+		tile, _, ok := app.TileCache.Get(key, hour)
+		if !ok {
+			var err error
+			tile, err = app.TileCalls.Do(ctx, key, func(ctx context.Context) ([]byte, error) {
+				tile, err := app.Tiles.HeatmapTile(ctx, mapType, z, x, y)
+				if err != nil {
+					return nil, err
+				}
+				if err := app.TileCache.Set(key, tile); err != nil {
+					slog.ErrorContext(ctx, "Error caching tile", "tile", key, "error", err)
+				}
+				return tile, nil
+			})
+			if errors.Is(err, metering.ErrBudgetExceeded) {
+				// Fall back on the last tile fetched, however old
+				if stale, _, found := app.TileCache.Get(key, time.Time{}); found {
+					tile, err = stale, nil
+				}
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "Error fetching tile", "tile", key, "error", err)
+				return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+					"success": false,
+					"error":   "Can't fetch tile",
+				})
+			}
+		}
+
+		sum := sha256.Sum256(tile)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		maxAge := int(hour.Add(time.Hour).Sub(now).Seconds())
+		c.Set(fiber.HeaderETag, etag)
+		c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", maxAge))
+		if c.Get(fiber.HeaderIfNoneMatch) == etag {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+		c.Set(fiber.HeaderContentType, "image/png")
+		return c.Status(fiber.StatusOK).Send(tile)
+	}
+}
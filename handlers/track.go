@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"github.com/Stutern-128/backend/geo"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/track"
+	"github.com/Stutern-128/backend/units"
+	"github.com/gofiber/fiber/v2"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ventilationRates are the adult breathing rates in m³/h assumed below each
+// speed in m/s, roughly the resting, walking, running and cycling activity
+// levels of the EPA Exposure Factors Handbook. Faster movement is taken to be
+// motorized.
+var ventilationRates = []struct {
+	belowSpeed float64
+	rate       float64
+}{
+	{0.5, 0.5},
+	{2, 1.2},
+	{4, 2.7},
+	{10, 1.8},
+	{math.Inf(1), 0.5},
+}
+
+func ventilationRate(metersPerSecond float64) float64 {
+	for _, v := range ventilationRates {
+		if metersPerSecond < v.belowSpeed {
+			return v.rate
+		}
+	}
+	return ventilationRates[len(ventilationRates)-1].rate
+}
+
+// maxTrackCells caps the history lookups per track; longer tracks are split
+// into larger geohash cells.
+const maxTrackCells = 60
+
+// cellHours is a location within a geohash cell and the hours of the track
+// spent in it.
+type cellHours struct {
+	latitude, longitude float64
+	from, to            time.Time
+}
+
+// trackPiece is a run of track points within one geohash cell and hour, so
+// sharing one hourly reading.
+type trackPiece struct {
+	points   []track.Point
+	cell     string
+	hour     time.Time
+	meters   float64
+	duration time.Duration
+}
+
+// splitTrack splits the segments of a track into pieces by geohash cell of the
+// given precision and hour, and returns the range of hours needed per cell.
+func splitTrack(trackSegments [][]track.Point, precision int) ([][]*trackPiece, map[string]*cellHours) {
+	segments := make([][]*trackPiece, len(trackSegments))
+	ranges := make(map[string]*cellHours)
+	for i, points := range trackSegments {
+		var piece *trackPiece
+		for j, point := range points {
+			cell := geo.Geohash(point.Latitude, point.Longitude, precision)
+			hour := point.Time.UTC().Truncate(time.Hour)
+			if piece == nil || piece.cell != cell || !piece.hour.Equal(hour) {
+				next := &trackPiece{cell: cell, hour: hour}
+				if piece != nil {
+					// Pieces join up, so the line has no gaps
+					next.points = append(next.points, points[j-1])
+				}
+				piece = next
+				segments[i] = append(segments[i], piece)
+			}
+			piece.points = append(piece.points, point)
+			if r, ok := ranges[cell]; !ok {
+				ranges[cell] = &cellHours{latitude: point.Latitude, longitude: point.Longitude, from: hour, to: hour}
+			} else if hour.Before(r.from) {
+				r.from = hour
+			} else if hour.After(r.to) {
+				r.to = hour
+			}
+		}
+		for _, piece := range segments[i] {
+			for k := 1; k < len(piece.points); k++ {
+				from, to := piece.points[k-1], piece.points[k]
+				piece.meters += geo.Distance(from.Latitude, from.Longitude, to.Latitude, to.Longitude)
+				if elapsed := to.Time.Sub(from.Time); elapsed > 0 {
+					piece.duration += elapsed
+				}
+			}
+		}
+	}
+	return segments, ranges
+}
+
+// checkTrackCells resolves the location of every cell of a track, so that
+// tracks crossing into unsupported countries are rejected as a whole.
+func (app *App) checkTrackCells(ctx context.Context, ranges map[string]*cellHours) error {
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, lookupConcurrency)
+	for _, r := range ranges {
+		wg.Add(1)
+		go func(r *cellHours) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if _, err := app.resolveLocation(ctx, r.latitude, r.longitude); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(r)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// HandleTrackExposure reads an uploaded GPX or GeoJSON track, as the "track"
+// form file or as the request body, and returns it as GeoJSON with the hourly
+// AQI and the inhaled pollutant dose on each piece of the track, summed up
+// per track segment.
+func (app *App) HandleTrackExposure() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		data := c.Body()
+		if strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEMultipartForm) {
+			file, err := c.FormFile("track")
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"error":   "Track file is required",
+				})
+			}
+			f, err := file.Open()
+			if err == nil {
+				data, err = io.ReadAll(f)
+				f.Close()
+			}
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"error":   err.Error(),
+				})
+			}
+		}
+		parsed, err := track.Parse(data)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		preferredIndex := c.Query("preferredIndex")
+
+		// Every cell is a history lookup, so long tracks use coarser cells
+		precision := app.Config.CACHE_GEOHASH_PRECISION
+		segments, ranges := splitTrack(parsed.Segments, precision)
+		for len(ranges) > maxTrackCells && precision > 1 {
+			precision--
+			segments, ranges = splitTrack(parsed.Segments, precision)
+		}
+		if err := app.checkTrackCells(ctx, ranges); err != nil {
+			return c.Status(locationStatus(err)).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+
+		readings := make(map[string]map[time.Time]*models.AirQuality, len(ranges))
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, lookupConcurrency)
+		for cell, r := range ranges {
+			wg.Add(1)
+			go func(cell string, r *cellHours) {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				hours, err := app.hourlyHistory(ctx, r.latitude, r.longitude, r.from, r.to.Add(time.Hour))
+				if err != nil {
+					slog.ErrorContext(ctx, "Error fetching history", "cell", cell, "error", err)
+					return
+				}
+				byHour := make(map[time.Time]*models.AirQuality, len(hours))
+				for i := range hours {
+					byHour[hours[i].DateTime.UTC().Truncate(time.Hour)] = &hours[i]
+				}
+				mu.Lock()
+				readings[cell] = byHour
+				mu.Unlock()
+			}(cell, r)
+		}
+		wg.Wait()
+
+		var features []interface{}
+		var summaries []interface{}
+		for i, pieces := range segments {
+			var meters, aqiSeconds, weightedAqi, coveredSeconds float64
+			var duration time.Duration
+			maxAqi := -1
+			var aqiCode string
+			doses := make(map[string]float64)
+			for _, piece := range pieces {
+				meters += piece.meters
+				duration += piece.duration
+				if len(piece.points) < 2 {
+					continue
+				}
+				coordinates := make([][]float64, len(piece.points))
+				for k, point := range piece.points {
+					coordinates[k] = []float64{point.Longitude, point.Latitude}
+				}
+				properties := fiber.Map{
+					"segment":         i,
+					"startTime":       piece.points[0].Time,
+					"endTime":         piece.points[len(piece.points)-1].Time,
+					"distanceMeters":  math.Round(piece.meters),
+					"durationSeconds": piece.duration.Seconds(),
+				}
+				features = append(features, fiber.Map{
+					"type":       "Feature",
+					"geometry":   fiber.Map{"type": "LineString", "coordinates": coordinates},
+					"properties": properties,
+				})
+
+				airQuality := readings[piece.cell][piece.hour]
+				if airQuality == nil {
+					continue
+				}
+				index, _, ok := selectIndexes(airQuality, preferredIndex)
+				if ok && aqiCode == "" {
+					aqiCode = index.Code
+				}
+				if ok && index.Code == aqiCode {
+					properties["aqiCode"] = index.Code
+					properties["aqi"] = index.Aqi
+					properties["aqiCategory"] = index.Category
+					properties["aqiColor"] = index.Color
+					properties["dominantPollutantCode"] = index.DominantPollutant
+					seconds := piece.duration.Seconds()
+					weightedAqi += float64(index.Aqi) * seconds
+					aqiSeconds += seconds
+					if index.Aqi > maxAqi {
+						maxAqi = index.Aqi
+					}
+				}
+				pieceDoses := pollutantDoses(airQuality, piece)
+				for code, dose := range pieceDoses {
+					doses[code] += dose
+				}
+				if len(pieceDoses) > 0 {
+					properties["doses"] = roundDoses(pieceDoses)
+					coveredSeconds += piece.duration.Seconds()
+				}
+			}
+			summary := fiber.Map{
+				"segment":         i,
+				"distanceMeters":  math.Round(meters),
+				"durationSeconds": duration.Seconds(),
+				"doses":           roundDoses(doses),
+			}
+			if duration > 0 {
+				// Share of the time with hourly readings to base the doses on
+				summary["coverage"] = math.Round(coveredSeconds/duration.Seconds()*100) / 100
+			}
+			if aqiSeconds > 0 {
+				summary["aqiCode"] = aqiCode
+				summary["averageAqi"] = math.Round(weightedAqi/aqiSeconds*10) / 10
+				summary["maxAqi"] = maxAqi
+			}
+			summaries = append(summaries, summary)
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"type": "FeatureCollection",
+			"properties": fiber.Map{
+				"name":     parsed.Name,
+				"segments": summaries,
+			},
+			"features": features,
+		})
+	}
+}
+
+// pollutantDoses returns the mass in μg of each pollutant inhaled on a piece
+// of track, at a breathing rate that depends on the speed.
+func pollutantDoses(airQuality *models.AirQuality, piece *trackPiece) map[string]float64 {
+	hours := piece.duration.Hours()
+	if hours <= 0 {
+		return nil
+	}
+	rate := ventilationRate(piece.meters / piece.duration.Seconds())
+	doses := make(map[string]float64)
+	for _, pollutant := range airQuality.Pollutants {
+		concentration, err := units.Convert(pollutant.Code, pollutant.Concentration.Value, pollutant.Concentration.Units,
+			units.MicrogramsPerCubicMeter, units.Conditions{})
+		if err == nil {
+			doses[pollutant.Code] = concentration * rate * hours
+		}
+	}
+	return doses
+}
+
+// roundDoses rounds doses to hundredths of a μg in place.
+func roundDoses(doses map[string]float64) map[string]float64 {
+	for code, dose := range doses {
+		doses[code] = math.Round(dose*100) / 100
+	}
+	return doses
+}
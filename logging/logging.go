@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"github.com/Stutern-128/backend/geo"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// cellPrecision is the geohash precision locations are logged at, cells of
+// about 5 km, so logs don't hold the exact places clients look up.
+const cellPrecision = 5
+
+// keyParam matches API keys passed in URL query parameters.
+var keyParam = regexp.MustCompile(`([?&](?:key|api_key)=)[^&\s"']+`)
+
+// Setup installs the default logger, writing format ("json" or "text") to w
+// at level ("debug", "info", "warn" or "error"). The secrets, and API keys in
+// URL query parameters, are redacted from every message and attribute.
+func Setup(w io.Writer, format string, level string, secrets ...string) error {
+	var minLevel slog.Level
+	if level != "" {
+		if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("unknown log level %q", level)
+		}
+	}
+	redactor := newRedactor(secrets)
+	options := &slog.HandlerOptions{
+		Level: minLevel,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			switch a.Value.Kind() {
+			case slog.KindString:
+				a.Value = slog.StringValue(redactor.Replace(a.Value.String()))
+			case slog.KindAny:
+				if err, ok := a.Value.Any().(error); ok {
+					a.Value = slog.StringValue(redactor.Replace(err.Error()))
+				}
+			}
+			return a
+		},
+	}
+	var handler slog.Handler
+	switch format {
+	case "", "text":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	return nil
+}
+
+// redactor hides secrets and API key query parameters.
+type redactor struct {
+	secrets *strings.Replacer
+}
+
+func newRedactor(secrets []string) redactor {
+	var pairs []string
+	for _, secret := range secrets {
+		if secret != "" {
+			pairs = append(pairs, secret, "REDACTED")
+		}
+	}
+	return redactor{secrets: strings.NewReplacer(pairs...)}
+}
+
+func (r redactor) Replace(s string) string {
+	return keyParam.ReplaceAllString(r.secrets.Replace(s), "${1}REDACTED")
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose log records carry requestID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// contextHandler adds the request ID and the trace ID of the context to
+// every record logged with one.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID, ok := ctx.Value(requestIDKey{}).(string); ok {
+		record.AddAttrs(slog.String("requestId", requestID))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.HasTraceID() {
+		record.AddAttrs(slog.String("traceId", span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Cell is the log attribute of a location, quantized to a geohash cell.
+func Cell(latitude float64, longitude float64) slog.Attr {
+	return slog.String("cell", geo.Geohash(latitude, longitude, cellPrecision))
+}
+
+// Upstream logs a call to method of an upstream api that started at start,
+// answered with status (zero if unknown) and failed if err is set.
+func Upstream(ctx context.Context, api string, method string, status int, start time.Time, err error) {
+	attrs := []slog.Attr{
+		slog.String("api", api),
+		slog.String("method", method),
+		slog.Duration("latency", time.Since(start)),
+	}
+	if status != 0 {
+		attrs = append(attrs, slog.Int("status", status))
+	}
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelWarn, "Upstream call failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+	slog.LogAttrs(ctx, slog.LevelDebug, "Upstream call", attrs...)
+}
@@ -1,52 +1,362 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"github.com/Stutern-128/backend/alerts"
+	"github.com/Stutern-128/backend/auth"
+	"github.com/Stutern-128/backend/cache"
+	"github.com/Stutern-128/backend/coalesce"
 	"github.com/Stutern-128/backend/conf"
 	"github.com/Stutern-128/backend/handlers"
 	_ "github.com/Stutern-128/backend/handlers"
+	"github.com/Stutern-128/backend/logging"
+	"github.com/Stutern-128/backend/metering"
+	"github.com/Stutern-128/backend/metrics"
+	"github.com/Stutern-128/backend/poller"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/Stutern-128/backend/store"
+	"github.com/Stutern-128/backend/stream"
+	"github.com/Stutern-128/backend/tracing"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"googlemaps.github.io/maps"
-	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// upstreamTimeout bounds coalesced Google calls, which no longer follow the
+// deadline of any one request.
+const upstreamTimeout = 30 * time.Second
+
+// shutdownTimeout bounds draining requests and flushing usage and traces on
+// exit.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	app := fiber.New()
 	config := conf.GetConfig()
+	if err := logging.Setup(os.Stdout, config.LOG_FORMAT, config.LOG_LEVEL,
+		config.API_KEY, config.ADMIN_API_KEY, config.OPENAQ_API_KEY); err != nil {
+		fatal("Error setting up logging", err)
+	}
+
+	cacheTTL := time.Duration(config.CACHE_TTL_MINUTES) * time.Minute
+
+	shutdownTracing, err := tracing.Setup(config.TRACING_EXPORTER, config.TRACING_OTLP_ENDPOINT,
+		"zephyr-backend", config.VERSION, config.TRACING_SAMPLE_RATIO)
+	if err != nil {
+		fatal("Error setting up tracing", err)
+	}
+	// Stop on SIGINT or SIGTERM so that buffered spans and usage are saved
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	historyStore := createStore(&config)
+	meter := createMeter(&config, historyStore)
+	pollen := providers.NewGooglePollen(config.POLLEN_BASE_URL, config.API_KEY, config.POLLEN_SUPPORTED_COUNTRIES)
+	pollen.Meter = meter
+	tiles := providers.NewGoogle(config.AIR_QUALITY_BASE_URL, config.API_KEY)
+	tiles.Meter = meter
+	airQuality := providers.NewCached(createAirQualityProvider(&config, meter),
+		config.CACHE_GEOHASH_PRECISION, cacheTTL, config.CACHE_MAX_ENTRIES)
 
 	// Initialize the Maps client during the application startup
 	appInstance := &handlers.App{
-		MapsClient: createMapsClient(&config),
-		Config:     &config,
+		MapsClient: &metering.Maps{Client: createMapsClient(&config), Meter: meter},
+		AirQuality: airQuality,
+		Pollen:     pollen,
+		// Addresses rarely change, so geocodes are kept for a day
+		GeocodeCache: cache.New[maps.GeocodingResult](24*time.Hour, config.CACHE_MAX_ENTRIES),
+		GeocodeCalls: coalesce.Group[maps.GeocodingResult]{Timeout: upstreamTimeout},
+		Tiles:        tiles,
+		TileCache:    createTileCache(&config),
+		TileCalls:    coalesce.Group[[]byte]{Timeout: upstreamTimeout},
+		Store:        historyStore,
+		Meter:        meter,
+		Config:       &config,
 	}
+	metrics.RegisterCache("currentConditions", airQuality.Stats)
+	metrics.RegisterCache("geocode", appInstance.GeocodeCache.Stats)
+	metrics.RegisterCache("tiles", appInstance.TileCache.Stats)
+	appInstance.Streams = stream.NewHub(appInstance.AirQuality, config.CACHE_GEOHASH_PRECISION, streamPollInterval(&config))
 
+	app.Use(appInstance.InstrumentRequests())
+	app.Use(appInstance.TraceRequests())
+	app.Use(appInstance.LogRequests())
 	app.Use(cors.New(cors.Config{
 		AllowOriginsFunc: func(origin string) bool {
-			return true
+			for _, allowed := range config.CORS_ALLOWED_ORIGINS {
+				if origin == allowed {
+					return true
+				}
+			}
+			return false
 		},
+		ExposeHeaders: "X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, " +
+			"X-RateLimit-Daily-Limit, X-RateLimit-Daily-Remaining, X-RateLimit-Daily-Reset, Retry-After, X-Request-ID",
 	}))
+	// The page is served before authentication, the API calls it makes are not
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendFile("./index.html")
+	})
+	if config.AUTH_ENABLED {
+		if appInstance.Store == nil {
+			slog.Error("AUTH_ENABLED needs HISTORY_DB_PATH to store API keys")
+			os.Exit(1)
+		}
+		if config.ADMIN_API_KEY == "" && !hasAdminKey(historyStore) {
+			slog.Error("AUTH_ENABLED needs ADMIN_API_KEY to issue the first API key")
+			os.Exit(1)
+		}
+		appInstance.Limiter = auth.NewLimiter()
+		app.Use(appInstance.RequireAPIKey())
+		app.Use("/admin", appInstance.RequireAdmin())
+		app.Use("/metrics", appInstance.RequireAdmin())
+	} else {
+		slog.Warn("API key authentication is disabled, every route but /admin is public and per-user routes are off")
+		app.Use("/admin", appInstance.RequireAdminKey())
+	}
 
 	app.Post("/aqi", appInstance.HandleGetAQI())
+	app.Get("/aqi/stream", appInstance.HandleStreamAQI())
 	app.Post("/pollutants", appInstance.HandleGetPollutants())
 	app.Post("/pollutantsAdditionalInfo", appInstance.HandleGetPollutantsAdditionalInfo())
 	app.Post("/nearbyPlaces", appInstance.HandleNearByPlaces())
 	app.Post("/searchPlaces", appInstance.HandleSearch())
 	app.Post("/chart", appInstance.HandleChart())
-	app.Get("/", func(c *fiber.Ctx) error {
-		return c.SendFile("./index.html")
-	})
+	app.Post("/forecast", appInstance.HandleForecast())
+	app.Post("/health", appInstance.HandleGetHealth())
+	app.Post("/pollen", appInstance.HandlePollen())
+	app.Get("/tiles/:mapType/:z/:x/:y", appInstance.HandleHeatmapTile())
+	app.Post("/route", appInstance.HandleRoute())
+	app.Post("/track", appInstance.HandleTrackExposure())
+	app.Post("/compare", appInstance.HandleCompare())
+	app.Get("/admin/cache", appInstance.HandleCacheStats())
+	app.Get("/admin/usage", appInstance.HandleUsage())
+	app.Get("/metrics", appInstance.HandleMetrics())
+	var evaluatorDone chan struct{}
+	if appInstance.Store != nil {
+		go meter.Run(ctx, time.Minute)
+		appInstance.Poller = createPoller(appInstance, &config)
+		app.Get("/admin/keys", appInstance.HandleListKeys())
+		app.Post("/admin/keys", appInstance.HandleIssueKey())
+		app.Delete("/admin/keys/:id", appInstance.HandleRevokeKey())
+		app.Get("/admin/tracked", appInstance.HandleListTracked())
+		app.Post("/admin/tracked", appInstance.HandleAddTracked())
+		app.Delete("/admin/tracked/:id", appInstance.HandleRemoveTracked())
+
+		evaluatorDone = make(chan struct{})
+		go func() {
+			defer close(evaluatorDone)
+			createEvaluator(appInstance, &config).Run(ctx)
+		}()
+	}
+	// Per-user data is owned by API keys, so it needs authentication
+	if config.AUTH_ENABLED {
+		app.Get("/subscriptions", appInstance.HandleListSubscriptions())
+		app.Post("/subscriptions", appInstance.HandleCreateSubscription())
+		app.Get("/subscriptions/:id", appInstance.HandleGetSubscription())
+		app.Put("/subscriptions/:id", appInstance.HandleUpdateSubscription())
+		app.Delete("/subscriptions/:id", appInstance.HandleDeleteSubscription())
+
+		app.Get("/health/profile", appInstance.HandleGetHealthProfile())
+		app.Put("/health/profile", appInstance.HandleSaveHealthProfile())
+		app.Delete("/health/profile", appInstance.HandleDeleteHealthProfile())
+
+		app.Get("/locations", appInstance.HandleListSavedLocations())
+		app.Post("/locations", appInstance.HandleCreateSavedLocation())
+		app.Get("/locations/:id", appInstance.HandleGetSavedLocation())
+		app.Put("/locations/:id", appInstance.HandleUpdateSavedLocation())
+		app.Delete("/locations/:id", appInstance.HandleDeleteSavedLocation())
+		app.Get("/dashboard", appInstance.HandleDashboard())
+	}
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(":3000")
+	}()
+	var serveErr error
+	select {
+	case serveErr = <-listenErr:
+		slog.Error("Error running server", "error", serveErr)
+	case <-ctx.Done():
+		slog.Info("Shutting down")
+	}
 
-	err := app.Listen(":3000")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := app.ShutdownWithContext(shutdownCtx); err != nil {
+		slog.Error("Error shutting down server", "error", err)
+	}
+	// Background work writes to the store, so it ends before the last usage
+	// flush and before the store is closed
+	stop()
+	if appInstance.Poller != nil {
+		appInstance.Poller.Stop()
+	}
+	if evaluatorDone != nil {
+		<-evaluatorDone
+	}
+	if err := meter.Flush(shutdownCtx); err != nil {
+		slog.Error("Error saving upstream usage", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+	if historyStore != nil {
+		if err := historyStore.Close(); err != nil {
+			slog.Error("Error closing history store", "error", err)
+		}
+	}
+	if serveErr != nil {
+		os.Exit(1)
+	}
+}
+
+// hasAdminKey reports whether the store holds an admin key that isn't revoked.
+func hasAdminKey(historyStore *store.Store) bool {
+	keys, err := historyStore.APIKeys(context.Background())
 	if err != nil {
-		panic(err)
+		fatal("Error loading API keys", err)
+	}
+	for _, key := range keys {
+		if key.Admin && key.RevokedAt == nil {
+			return true
+		}
 	}
+	return false
 }
 
 // createMapsClient initializes and returns a Google Maps client
 func createMapsClient(config *conf.Configuration) *maps.Client {
 	client, err := maps.NewClient(maps.WithAPIKey(config.API_KEY))
 	if err != nil {
-		log.Fatal(err)
+		fatal("Error creating Maps client", err)
 	}
 	return client
 }
+
+// createAirQualityProvider returns the air quality backend selected by AIR_QUALITY_PROVIDER
+func createAirQualityProvider(config *conf.Configuration, meter *metering.Meter) providers.AirQualityProvider {
+	switch config.AIR_QUALITY_PROVIDER {
+	case "", "google":
+		google := providers.NewGoogle(config.AIR_QUALITY_BASE_URL, config.API_KEY)
+		google.Meter = meter
+		return google
+	case "openaq":
+		openAQ := providers.NewOpenAQ(config.OPENAQ_BASE_URL, config.OPENAQ_API_KEY, config.OPENAQ_RADIUS)
+		openAQ.Meter = meter
+		return openAQ
+	}
+	slog.Error("Unknown air quality provider", "provider", config.AIR_QUALITY_PROVIDER)
+	os.Exit(1)
+	return nil
+}
+
+// createMeter returns the meter pricing and capping upstream calls, carrying on
+// with the usage of the current month when there is a history database
+func createMeter(config *conf.Configuration, usageStore *store.Store) *metering.Meter {
+	skus := make([]metering.SKU, len(config.UPSTREAM_SKUS))
+	for i, sku := range config.UPSTREAM_SKUS {
+		skus[i] = metering.SKU{
+			Name:             sku.SKU,
+			PricePerThousand: sku.PricePerThousand,
+			MonthlyBudget:    sku.MonthlyBudget,
+			Optional:         sku.Optional,
+		}
+	}
+	meter, err := metering.New(skus, config.UPSTREAM_MONTHLY_BUDGET, config.UPSTREAM_DEGRADE_PERCENT, usageStore)
+	if err != nil {
+		fatal("Error loading upstream usage", err)
+	}
+	return meter
+}
+
+// createTileCache opens the disk cache for heatmap tiles
+func createTileCache(config *conf.Configuration) *cache.Disk {
+	tileCache, err := cache.NewDisk(config.TILE_CACHE_DIR, int64(config.TILE_CACHE_MAX_MB)<<20)
+	if err != nil {
+		fatal("Error opening tile cache", err)
+	}
+	return tileCache
+}
+
+// createStore opens the local history database and starts pruning readings past the retention period
+func createStore(config *conf.Configuration) *store.Store {
+	if config.HISTORY_DB_PATH == "" {
+		return nil
+	}
+	historyStore, err := store.Open(config.HISTORY_DB_PATH)
+	if err != nil {
+		fatal("Error opening history database", err)
+	}
+	if config.HISTORY_RETENTION_DAYS > 0 {
+		go historyStore.EnforceRetention(time.Duration(config.HISTORY_RETENTION_DAYS) * 24 * time.Hour)
+	}
+	return historyStore
+}
+
+// createPoller starts polling the configured and previously tracked locations
+func createPoller(appInstance *handlers.App, config *conf.Configuration) *poller.Poller {
+	locationPoller := poller.New(appInstance.AirQuality, appInstance.Store, config.CACHE_GEOHASH_PRECISION,
+		config.POLLER_CONCURRENCY, time.Duration(config.POLLER_JITTER_SECONDS)*time.Second)
+	for i, location := range config.TRACKED_LOCATIONS {
+		interval := location.IntervalMinutes
+		if interval <= 0 {
+			interval = config.POLLER_DEFAULT_INTERVAL_MINUTES
+		}
+		locationPoller.Track(fmt.Sprintf("config:%d", i), store.TrackedLocation{
+			Name:            location.Name,
+			Latitude:        location.Latitude,
+			Longitude:       location.Longitude,
+			IntervalMinutes: interval,
+		})
+	}
+	tracked, err := appInstance.Store.TrackedLocations(context.Background())
+	if err != nil {
+		fatal("Error loading tracked locations", err)
+	}
+	for _, location := range tracked {
+		locationPoller.Track(handlers.TrackedKey(location.ID), location)
+	}
+	return locationPoller
+}
+
+// createEvaluator returns the alert evaluator delivering subscription webhooks
+func createEvaluator(appInstance *handlers.App, config *conf.Configuration) *alerts.Evaluator {
+	interval := time.Duration(config.ALERTS_INTERVAL_MINUTES) * time.Minute
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+	maxAttempts := config.WEBHOOK_MAX_ATTEMPTS
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	return &alerts.Evaluator{
+		Provider: appInstance.AirQuality,
+		Store:    appInstance.Store,
+		Sender: &alerts.Sender{
+			MaxAttempts: maxAttempts,
+			Backoff:     time.Duration(config.WEBHOOK_BACKOFF_SECONDS) * time.Second,
+			Timeout:     time.Duration(config.WEBHOOK_TIMEOUT_SECONDS) * time.Second,
+		},
+		Interval: interval,
+	}
+}
+
+// streamPollInterval is how often a streamed location cell is polled, five minutes unless configured
+func streamPollInterval(config *conf.Configuration) time.Duration {
+	if config.STREAM_POLL_SECONDS <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(config.STREAM_POLL_SECONDS) * time.Second
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
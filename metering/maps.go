@@ -0,0 +1,71 @@
+package metering
+
+import (
+	"context"
+	"github.com/Stutern-128/backend/logging"
+	"github.com/Stutern-128/backend/metrics"
+	"github.com/Stutern-128/backend/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"googlemaps.github.io/maps"
+	"time"
+)
+
+// Maps wraps a Google Maps client, recording every call on a meter before
+// making it and timing and tracing the calls made.
+type Maps struct {
+	Client *maps.Client
+	Meter  *Meter
+}
+
+func (m *Maps) ReverseGeocode(ctx context.Context, r *maps.GeocodingRequest) (_ []maps.GeocodingResult, err error) {
+	if err := m.Meter.Record(ctx, SKUGeocoding, "reverseGeocode"); err != nil {
+		return nil, err
+	}
+	ctx, span := tracing.StartUpstream(ctx, "maps", "reverseGeocode")
+	defer observe(ctx, span, "reverseGeocode", time.Now(), &err)
+	return m.Client.ReverseGeocode(ctx, r)
+}
+
+func (m *Maps) FindPlaceFromText(ctx context.Context, r *maps.FindPlaceFromTextRequest) (_ maps.FindPlaceFromTextResponse, err error) {
+	if err := m.Meter.Record(ctx, SKUFindPlace, "findPlaceFromText"); err != nil {
+		return maps.FindPlaceFromTextResponse{}, err
+	}
+	ctx, span := tracing.StartUpstream(ctx, "maps", "findPlaceFromText")
+	defer observe(ctx, span, "findPlaceFromText", time.Now(), &err)
+	return m.Client.FindPlaceFromText(ctx, r)
+}
+
+func (m *Maps) Timezone(ctx context.Context, r *maps.TimezoneRequest) (_ *maps.TimezoneResult, err error) {
+	if err := m.Meter.Record(ctx, SKUTimeZone, "timezone"); err != nil {
+		return nil, err
+	}
+	ctx, span := tracing.StartUpstream(ctx, "maps", "timezone")
+	defer observe(ctx, span, "timezone", time.Now(), &err)
+	return m.Client.Timezone(ctx, r)
+}
+
+func (m *Maps) NearbySearch(ctx context.Context, r *maps.NearbySearchRequest) (_ maps.PlacesSearchResponse, err error) {
+	if err := m.Meter.Record(ctx, SKUNearbySearch, "nearbySearch"); err != nil {
+		return maps.PlacesSearchResponse{}, err
+	}
+	ctx, span := tracing.StartUpstream(ctx, "maps", "nearbySearch")
+	defer observe(ctx, span, "nearbySearch", time.Now(), &err)
+	return m.Client.NearbySearch(ctx, r)
+}
+
+func (m *Maps) Directions(ctx context.Context, r *maps.DirectionsRequest) (_ []maps.Route, _ []maps.GeocodedWaypoint, err error) {
+	if err := m.Meter.Record(ctx, SKUDirections, "directions"); err != nil {
+		return nil, nil, err
+	}
+	ctx, span := tracing.StartUpstream(ctx, "maps", "directions")
+	defer observe(ctx, span, "directions", time.Now(), &err)
+	return m.Client.Directions(ctx, r)
+}
+
+// observe records a Maps call in the metrics, the trace and the log once it
+// has returned err.
+func observe(ctx context.Context, span trace.Span, method string, start time.Time, err *error) {
+	metrics.ObserveUpstream("maps", method, start, *err)
+	tracing.End(span, *err)
+	logging.Upstream(ctx, "maps", method, 0, start, *err)
+}
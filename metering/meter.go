@@ -0,0 +1,338 @@
+package metering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Stutern-128/backend/store"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SKUs of the billed Google APIs, named after the Google Maps Platform price
+// list, and of OpenAQ, which is free but counted alongside them.
+const (
+	SKUGeocoding    = "geocoding"
+	SKUFindPlace    = "find_place"
+	SKUTimeZone     = "time_zone"
+	SKUNearbySearch = "nearby_search"
+	SKUDirections   = "directions"
+	SKUAirQuality   = "air_quality"
+	SKUHeatmapTile  = "air_quality_heatmap_tile"
+	SKUPollen       = "pollen"
+	SKUOpenAQ       = "openaq"
+)
+
+// internalClient is the client that calls made outside of a client request,
+// such as polls and alert checks, are counted against.
+const internalClient = "internal"
+
+// ErrBudgetExceeded is returned instead of making a call that the monthly
+// budgets don't leave room for.
+var ErrBudgetExceeded = errors.New("upstream budget exceeded")
+
+// SKU is the price and budget of a billed upstream SKU.
+type SKU struct {
+	Name string
+	// PricePerThousand is the price in USD of 1000 calls
+	PricePerThousand float64
+	// MonthlyBudget caps the spend on the SKU in USD per month; zero means no cap
+	MonthlyBudget float64
+	// Optional SKUs are refused once any budget is nearly spent, to keep the
+	// rest of it for the calls that can't be done without
+	Optional bool
+}
+
+type usageKey struct {
+	month, sku, client, endpoint string
+}
+
+// Meter counts the calls made to billed upstream APIs per SKU, client and
+// endpoint, estimates their cost from a price table and refuses calls past
+// the monthly budgets. Counts are kept in memory and written to the store in
+// batches. A nil Meter counts nothing and allows every call.
+type Meter struct {
+	skus          map[string]SKU
+	monthlyBudget float64
+	degradeAt     float64
+	store         *store.Store
+
+	mu      sync.Mutex
+	month   string
+	counts  map[usageKey]int64
+	calls   map[string]int64
+	pending map[usageKey]int64
+}
+
+// New returns a meter pricing calls from skus. monthlyBudget caps the total
+// spend in USD per month and optional SKUs are refused once degradePercent of
+// a budget is spent. With a store, the usage of the current month is loaded
+// from it so budgets carry over restarts.
+func New(skus []SKU, monthlyBudget float64, degradePercent int, usageStore *store.Store) (*Meter, error) {
+	m := &Meter{
+		skus:          make(map[string]SKU, len(skus)),
+		monthlyBudget: monthlyBudget,
+		degradeAt:     float64(degradePercent) / 100,
+		store:         usageStore,
+		month:         CurrentMonth(),
+		counts:        make(map[usageKey]int64),
+		calls:         make(map[string]int64),
+		pending:       make(map[usageKey]int64),
+	}
+	if m.degradeAt <= 0 || m.degradeAt > 1 {
+		m.degradeAt = 1
+	}
+	for _, sku := range skus {
+		m.skus[sku.Name] = sku
+	}
+	if usageStore != nil {
+		usage, err := usageStore.UpstreamUsage(context.Background(), m.month)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range usage {
+			m.counts[usageKey{u.Month, u.SKU, u.Client, u.Endpoint}] += u.Calls
+			m.calls[u.SKU] += u.Calls
+		}
+	}
+	return m, nil
+}
+
+type clientKey struct{}
+
+// WithClient returns a context attributing the upstream calls made with it to client.
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// Client returns the client the calls made with ctx are attributed to.
+func Client(ctx context.Context) string {
+	if client, ok := ctx.Value(clientKey{}).(string); ok && client != "" {
+		return client
+	}
+	return internalClient
+}
+
+// Record counts a call to endpoint of sku made for the client of ctx, or
+// returns an error wrapping ErrBudgetExceeded if the call must not be made.
+func (m *Meter) Record(ctx context.Context, sku string, endpoint string) error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if month := CurrentMonth(); month != m.month {
+		m.month = month
+		m.counts = make(map[usageKey]int64)
+		m.calls = make(map[string]int64)
+	}
+	if err := m.allow(sku); err != nil {
+		return err
+	}
+	key := usageKey{m.month, sku, Client(ctx), endpoint}
+	m.counts[key]++
+	m.calls[sku]++
+	m.pending[key]++
+	return nil
+}
+
+// allow checks one more call to sku against the budgets. m.mu must be held.
+func (m *Meter) allow(sku string) error {
+	price := m.skus[sku]
+	cost := price.PricePerThousand / 1000
+	total := m.totalCost()
+	spent := float64(m.calls[sku]) * cost
+	if m.monthlyBudget > 0 && total+cost > m.monthlyBudget {
+		return fmt.Errorf("%w: monthly budget of %.2f USD spent", ErrBudgetExceeded, m.monthlyBudget)
+	}
+	if price.MonthlyBudget > 0 && spent+cost > price.MonthlyBudget {
+		return fmt.Errorf("%w: %s budget of %.2f USD spent", ErrBudgetExceeded, sku, price.MonthlyBudget)
+	}
+	if price.Optional && m.degraded() {
+		return fmt.Errorf("%w: %s is paused until the budgets reset", ErrBudgetExceeded, sku)
+	}
+	return nil
+}
+
+// degraded reports whether the total or any SKU spend has passed the share
+// of its budget at which optional SKUs are refused. m.mu must be held.
+func (m *Meter) degraded() bool {
+	if m.monthlyBudget > 0 && m.totalCost() >= m.monthlyBudget*m.degradeAt {
+		return true
+	}
+	for name, sku := range m.skus {
+		if sku.MonthlyBudget > 0 && float64(m.calls[name])*sku.PricePerThousand/1000 >= sku.MonthlyBudget*m.degradeAt {
+			return true
+		}
+	}
+	return false
+}
+
+// totalCost is the spend of the current month. m.mu must be held.
+func (m *Meter) totalCost() float64 {
+	var total float64
+	for sku, calls := range m.calls {
+		total += float64(calls) * m.skus[sku].PricePerThousand / 1000
+	}
+	return total
+}
+
+// Flush writes the counts recorded since the last flush to the store.
+func (m *Meter) Flush(ctx context.Context) error {
+	if m == nil || m.store == nil {
+		return nil
+	}
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[usageKey]int64)
+	m.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	usage := make([]store.UpstreamUsage, 0, len(pending))
+	for key, calls := range pending {
+		usage = append(usage, store.UpstreamUsage{
+			Month:    key.month,
+			SKU:      key.sku,
+			Client:   key.client,
+			Endpoint: key.endpoint,
+			Calls:    calls,
+		})
+	}
+	if err := m.store.AddUpstreamUsage(ctx, usage); err != nil {
+		// Keep the counts for the next flush
+		m.mu.Lock()
+		for key, calls := range pending {
+			m.pending[key] += calls
+		}
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Run flushes the counts to the store on an interval until ctx is done.
+func (m *Meter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Flush(ctx); err != nil {
+				slog.ErrorContext(ctx, "Error saving upstream usage", "error", err)
+			}
+		}
+	}
+}
+
+// Line is the usage and cost of one SKU, client or endpoint in a Report.
+type Line struct {
+	Name string `json:"name"`
+	// SKU is set on endpoint lines, as endpoint names repeat across APIs
+	SKU    string  `json:"sku,omitempty"`
+	Calls  int64   `json:"calls"`
+	Cost   float64 `json:"cost"`
+	Budget float64 `json:"budget,omitempty"`
+}
+
+// Report is the upstream usage of a month with its estimated cost in USD.
+type Report struct {
+	Month     string  `json:"month"`
+	Calls     int64   `json:"calls"`
+	Cost      float64 `json:"cost"`
+	Budget    float64 `json:"budget,omitempty"`
+	Degraded  bool    `json:"degraded"`
+	SKUs      []Line  `json:"skus"`
+	Clients   []Line  `json:"clients"`
+	Endpoints []Line  `json:"endpoints"`
+}
+
+// Report returns the usage of month, given as YYYY-MM, priced at the current
+// price table. Past months are read from the store.
+func (m *Meter) Report(ctx context.Context, month string) (*Report, error) {
+	m.mu.Lock()
+	current := month == m.month
+	var usage []store.UpstreamUsage
+	if current {
+		for key, calls := range m.counts {
+			usage = append(usage, store.UpstreamUsage{
+				Month:    key.month,
+				SKU:      key.sku,
+				Client:   key.client,
+				Endpoint: key.endpoint,
+				Calls:    calls,
+			})
+		}
+	}
+	degraded := current && m.degraded()
+	m.mu.Unlock()
+	if !current && m.store != nil {
+		var err error
+		usage, err = m.store.UpstreamUsage(ctx, month)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := &Report{Month: month, Budget: m.monthlyBudget, Degraded: degraded}
+	skus := make(map[string]*Line)
+	clients := make(map[string]*Line)
+	endpoints := make(map[string]*Line)
+	for name, sku := range m.skus {
+		skus[name] = &Line{Name: name, Budget: sku.MonthlyBudget}
+	}
+	for _, u := range usage {
+		cost := float64(u.Calls) * m.skus[u.SKU].PricePerThousand / 1000
+		report.Calls += u.Calls
+		report.Cost += cost
+		addLine(skus, u.SKU, Line{Name: u.SKU}, u.Calls, cost)
+		addLine(clients, u.Client, Line{Name: u.Client}, u.Calls, cost)
+		addLine(endpoints, u.SKU+" "+u.Endpoint, Line{Name: u.Endpoint, SKU: u.SKU}, u.Calls, cost)
+	}
+	report.Cost = roundCents(report.Cost)
+	report.SKUs = sortedLines(skus)
+	report.Clients = sortedLines(clients)
+	report.Endpoints = sortedLines(endpoints)
+	return report, nil
+}
+
+func addLine(lines map[string]*Line, key string, line Line, calls int64, cost float64) {
+	if _, ok := lines[key]; !ok {
+		lines[key] = &line
+	}
+	lines[key].Calls += calls
+	lines[key].Cost += cost
+}
+
+// sortedLines returns the lines from the most to the least expensive.
+func sortedLines(lines map[string]*Line) []Line {
+	sorted := make([]Line, 0, len(lines))
+	for _, line := range lines {
+		line.Cost = roundCents(line.Cost)
+		sorted = append(sorted, *line)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Cost != sorted[j].Cost {
+			return sorted[i].Cost > sorted[j].Cost
+		}
+		if sorted[i].Calls != sorted[j].Calls {
+			return sorted[i].Calls > sorted[j].Calls
+		}
+		return sorted[i].SKU+sorted[i].Name < sorted[j].SKU+sorted[j].Name
+	})
+	return sorted
+}
+
+func roundCents(usd float64) float64 {
+	return math.Round(usd*100) / 100
+}
+
+// CurrentMonth returns the UTC month usage is counted in, as YYYY-MM.
+func CurrentMonth() string {
+	return time.Now().UTC().Format("2006-01")
+}
@@ -0,0 +1,171 @@
+package metering
+
+import (
+	"context"
+	"errors"
+	"github.com/Stutern-128/backend/store"
+	"path/filepath"
+	"testing"
+)
+
+// record makes n calls to sku and returns how many were allowed.
+func record(m *Meter, sku string, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if err := m.Record(context.Background(), sku, "lookup"); err == nil {
+			allowed++
+		} else if !errors.Is(err, ErrBudgetExceeded) {
+			panic(err)
+		}
+	}
+	return allowed
+}
+
+func TestMeterBudgets(t *testing.T) {
+	tests := []struct {
+		name    string
+		skus    []SKU
+		budget  float64
+		sku     string
+		calls   int
+		allowed int
+	}{
+		{
+			name:    "no budget",
+			skus:    []SKU{{Name: SKUAirQuality, PricePerThousand: 5}},
+			sku:     SKUAirQuality,
+			calls:   100,
+			allowed: 100,
+		},
+		{
+			name:    "monthly budget",
+			skus:    []SKU{{Name: SKUAirQuality, PricePerThousand: 5}},
+			budget:  0.022,
+			sku:     SKUAirQuality,
+			calls:   10,
+			allowed: 4,
+		},
+		{
+			name:    "SKU budget",
+			skus:    []SKU{{Name: SKUAirQuality, PricePerThousand: 5, MonthlyBudget: 0.012}},
+			budget:  1,
+			sku:     SKUAirQuality,
+			calls:   10,
+			allowed: 2,
+		},
+		{
+			name:    "unpriced SKU",
+			skus:    nil,
+			budget:  0.01,
+			sku:     SKUPollen,
+			calls:   10,
+			allowed: 10,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := New(test.skus, test.budget, 100, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed := record(m, test.sku, test.calls); allowed != test.allowed {
+				t.Errorf("allowed %d of %d calls, want %d", allowed, test.calls, test.allowed)
+			}
+		})
+	}
+}
+
+func TestMeterDegradesOptionalSKUs(t *testing.T) {
+	m, err := New([]SKU{
+		{Name: SKUAirQuality, PricePerThousand: 100},
+		{Name: SKUGeocoding, PricePerThousand: 5, Optional: true},
+	}, 1, 80, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record(m, SKUGeocoding, 1) != 1 {
+		t.Error("optional call refused before the degrade threshold")
+	}
+	// 0.005 + 7 * 0.1 is still below 80% of the budget
+	record(m, SKUAirQuality, 7)
+	if record(m, SKUGeocoding, 1) != 1 {
+		t.Error("optional call refused below the degrade threshold")
+	}
+	record(m, SKUAirQuality, 1)
+	if record(m, SKUGeocoding, 1) != 0 {
+		t.Error("optional call allowed past the degrade threshold")
+	}
+	// Required calls go on until the budget itself is spent
+	if allowed := record(m, SKUAirQuality, 5); allowed != 1 {
+		t.Errorf("allowed %d required calls past the threshold, want 1", allowed)
+	}
+	report, err := m.Report(context.Background(), CurrentMonth())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Degraded || report.Calls != 11 {
+		t.Errorf("report degraded %v with %d calls, want degraded with 11", report.Degraded, report.Calls)
+	}
+}
+
+func TestMeterFlush(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	skus := []SKU{{Name: SKUAirQuality, PricePerThousand: 5}}
+	m, err := New(skus, 0.0325, 100, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record(m, SKUAirQuality, 2)
+	m.Record(WithClient(ctx, "abcd1234"), SKUAirQuality, "lookup")
+	if err := m.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing new to write
+	if err := m.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	record(m, SKUAirQuality, 1)
+	if err := m.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := s.UpstreamUsage(ctx, CurrentMonth())
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := make(map[string]int64)
+	for _, u := range usage {
+		calls[u.Client] += u.Calls
+	}
+	if calls[internalClient] != 3 || calls["abcd1234"] != 1 {
+		t.Errorf("stored calls = %v, want 3 internal and 1 for the client", calls)
+	}
+
+	// A restarted meter carries the spend over
+	restarted, err := New(skus, 0.0325, 100, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed := record(restarted, SKUAirQuality, 5); allowed != 2 {
+		t.Errorf("restarted meter allowed %d calls, want the 2 left in the budget", allowed)
+	}
+}
+
+func TestMapsRefusesOverBudget(t *testing.T) {
+	m, err := New([]SKU{{Name: SKUGeocoding, PricePerThousand: 5, Optional: true}}, 0.001, 80, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The client is never reached, so none is set
+	client := &Maps{Meter: m}
+	if _, err := client.ReverseGeocode(context.Background(), nil); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("err = %v, want ErrBudgetExceeded", err)
+	}
+}
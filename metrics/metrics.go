@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"github.com/Stutern-128/backend/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"sync"
+	"time"
+)
+
+const namespace = "zephyr"
+
+// Registry holds every metric served on /metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	InFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests being served.",
+	})
+	UpstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of calls to upstream APIs by API and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"api", "method"})
+	UpstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Failed calls to upstream APIs by API and method.",
+	}, []string{"api", "method"})
+	// LocationAQI is keyed on the poller key, as tracked location names need not be unique
+	LocationAQI = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tracked_location_aqi",
+		Help:      "Latest AQI of each tracked location by index code.",
+	}, []string{"key", "name", "code"})
+
+	caches = &cacheCollector{stats: make(map[string]func() cache.Stats)}
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Requests, RequestDuration, InFlight,
+		UpstreamDuration, UpstreamErrors,
+		LocationAQI,
+		caches,
+	)
+}
+
+// ObserveUpstream records a call to method of an upstream api that started at
+// start and failed if err is set.
+func ObserveUpstream(api string, method string, start time.Time, err error) {
+	UpstreamDuration.WithLabelValues(api, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		UpstreamErrors.WithLabelValues(api, method).Inc()
+	}
+}
+
+// RegisterCache exports the counts of a cache under name, reading them from
+// stats on every scrape.
+func RegisterCache(name string, stats func() cache.Stats) {
+	caches.mu.Lock()
+	defer caches.mu.Unlock()
+	caches.stats[name] = stats
+}
+
+var (
+	cacheHits = prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache", "hits_total"),
+		"Cache lookups served from the cache.", []string{"cache"}, nil)
+	cacheMisses = prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache", "misses_total"),
+		"Cache lookups that went upstream.", []string{"cache"}, nil)
+	cacheEntries = prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache", "entries"),
+		"Entries held in the cache.", []string{"cache"}, nil)
+	cacheHitRatio = prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache", "hit_ratio"),
+		"Share of cache lookups served from the cache since startup.", []string{"cache"}, nil)
+)
+
+// cacheCollector reports the counts the caches keep themselves.
+type cacheCollector struct {
+	mu    sync.Mutex
+	stats map[string]func() cache.Stats
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheHits
+	ch <- cacheMisses
+	ch <- cacheEntries
+	ch <- cacheHitRatio
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, stats := range c.stats {
+		s := stats()
+		ch <- prometheus.MustNewConstMetric(cacheHits, prometheus.CounterValue, float64(s.Hits), name)
+		ch <- prometheus.MustNewConstMetric(cacheMisses, prometheus.CounterValue, float64(s.Misses), name)
+		ch <- prometheus.MustNewConstMetric(cacheEntries, prometheus.GaugeValue, float64(s.Entries), name)
+		if lookups := s.Hits + s.Misses; lookups > 0 {
+			ch <- prometheus.MustNewConstMetric(cacheHitRatio, prometheus.GaugeValue, float64(s.Hits)/float64(lookups), name)
+		}
+	}
+}
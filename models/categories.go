@@ -0,0 +1,94 @@
+package models
+
+// categorySeverity ranks the categories of the indexes we know, from the
+// cleanest air (0) upwards.
+var categorySeverity = map[string][]string{
+	"uaqi": {
+		"Excellent air quality",
+		"Good air quality",
+		"Moderate air quality",
+		"Low air quality",
+		"Poor air quality",
+	},
+	"usa_epa": {
+		"Good air quality",
+		"Moderate air quality",
+		"Unhealthy air quality for sensitive groups",
+		"Unhealthy air quality",
+		"Very unhealthy air quality",
+		"Hazardous air quality",
+	},
+	"eu_caqi": {
+		"Very low air pollution",
+		"Low air pollution",
+		"Medium air pollution",
+		"High air pollution",
+		"Very high air pollution",
+	},
+	"gbr_defra": {
+		"Low air pollution",
+		"Moderate air pollution",
+		"High air pollution",
+		"Very high air pollution",
+	},
+	"ind_cpcb": {
+		"Good air quality",
+		"Satisfactory air quality",
+		"Moderate air quality",
+		"Poor air quality",
+		"Very poor air quality",
+		"Severe air quality",
+	},
+	"chn_mep": {
+		"Excellent air quality",
+		"Good air quality",
+		"Light air pollution",
+		"Moderate air pollution",
+		"Heavy air pollution",
+		"Severe air pollution",
+	},
+}
+
+// unhealthyCategory is the severity of the first category of each index that
+// affects the general population.
+var unhealthyCategory = map[string]int{
+	"uaqi":      3,
+	"usa_epa":   3,
+	"eu_caqi":   3,
+	"gbr_defra": 2,
+	"ind_cpcb":  3,
+	"chn_mep":   3,
+}
+
+// Severity ranks the index category from 0 for the cleanest air upwards. It
+// returns -1 when the index or category is unknown.
+func (i Index) Severity() int {
+	return CategorySeverity(i.Code, i.Category)
+}
+
+// CategorySeverity ranks a category of the index with the given code, see
+// Index.Severity.
+func CategorySeverity(code string, category string) int {
+	for severity, name := range categorySeverity[code] {
+		if name == category {
+			return severity
+		}
+	}
+	return -1
+}
+
+// HigherIsBetter reports whether a higher AQI value means cleaner air, which
+// is the case for the Universal AQI but not for most local indexes.
+func (i Index) HigherIsBetter() bool {
+	return i.Code == "uaqi"
+}
+
+// IsCategory reports whether category belongs to any index we know.
+func IsCategory(category string) bool {
+	for code := range categorySeverity {
+		if CategorySeverity(code, category) >= 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package models
+
+import "sort"
+
+// Population groups the Air Quality API writes health recommendations for,
+// named after their HealthRecommendations JSON fields.
+const (
+	GeneralPopulation      = "generalPopulation"
+	Elderly                = "elderly"
+	LungDiseasePopulation  = "lungDiseasePopulation"
+	HeartDiseasePopulation = "heartDiseasePopulation"
+	Athletes               = "athletes"
+	PregnantWomen          = "pregnantWomen"
+	Children               = "children"
+)
+
+// groupSensitivity is how many categories earlier a group feels the effects
+// of polluted air than the general population.
+var groupSensitivity = map[string]int{
+	GeneralPopulation:      0,
+	Athletes:               1,
+	Children:               1,
+	Elderly:                1,
+	PregnantWomen:          1,
+	HeartDiseasePopulation: 2,
+	LungDiseasePopulation:  2,
+}
+
+// IsHealthGroup reports whether group is one of the population groups.
+func IsHealthGroup(group string) bool {
+	_, ok := groupSensitivity[group]
+	return ok
+}
+
+// Recommendation is the advice for one population group.
+type Recommendation struct {
+	Group          string `json:"group"`
+	Recommendation string `json:"recommendation"`
+	// Severity ranks the advice: 0 while the category doesn't affect the
+	// group yet, then growing by one with every category above that
+	Severity int `json:"severity"`
+}
+
+// For returns the recommendation for a population group.
+func (h HealthRecommendations) For(group string) string {
+	switch group {
+	case GeneralPopulation:
+		return h.GeneralPopulation
+	case Elderly:
+		return h.Elderly
+	case LungDiseasePopulation:
+		return h.LungDiseasePopulation
+	case HeartDiseasePopulation:
+		return h.HeartDiseasePopulation
+	case Athletes:
+		return h.Athletes
+	case PregnantWomen:
+		return h.PregnantWomen
+	case Children:
+		return h.Children
+	}
+	return ""
+}
+
+// GroupSeverity returns how severe the category of index is for a group: 0 below
+// the category the group starts feeling the effects at, sensitive groups
+// earlier than the general population, and one more for every category above.
+// It is 0 for indexes or categories we don't know.
+func GroupSeverity(index Index, group string) int {
+	severity := index.Severity()
+	unhealthy, ok := unhealthyCategory[index.Code]
+	if severity < 0 || !ok {
+		return 0
+	}
+	onset := unhealthy - groupSensitivity[group]
+	if severity < onset {
+		return 0
+	}
+	return severity - onset + 1
+}
+
+// Rank returns the recommendations for the general population and the given
+// groups, most severe first for the category of index. Groups without a
+// recommendation are left out.
+func (h HealthRecommendations) Rank(index Index, groups []string) []Recommendation {
+	seen := make(map[string]bool)
+	var recommendations []Recommendation
+	for _, group := range append([]string{GeneralPopulation}, groups...) {
+		text := h.For(group)
+		if seen[group] || text == "" {
+			continue
+		}
+		seen[group] = true
+		recommendations = append(recommendations, Recommendation{
+			Group:          group,
+			Recommendation: text,
+			Severity:       GroupSeverity(index, group),
+		})
+	}
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		return recommendations[i].Severity > recommendations[j].Severity
+	})
+	return recommendations
+}
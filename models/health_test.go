@@ -0,0 +1,67 @@
+package models
+
+import "testing"
+
+func TestGroupSeverity(t *testing.T) {
+	tests := []struct {
+		index Index
+		group string
+		want  int
+	}{
+		{Index{Code: "usa_epa", Category: "Good air quality"}, LungDiseasePopulation, 0},
+		{Index{Code: "usa_epa", Category: "Moderate air quality"}, LungDiseasePopulation, 1},
+		{Index{Code: "usa_epa", Category: "Moderate air quality"}, Athletes, 0},
+		{Index{Code: "usa_epa", Category: "Unhealthy air quality for sensitive groups"}, Athletes, 1},
+		{Index{Code: "usa_epa", Category: "Unhealthy air quality for sensitive groups"}, GeneralPopulation, 0},
+		{Index{Code: "usa_epa", Category: "Unhealthy air quality"}, GeneralPopulation, 1},
+		{Index{Code: "usa_epa", Category: "Hazardous air quality"}, HeartDiseasePopulation, 5},
+		{Index{Code: "uaqi", Category: "Low air quality"}, GeneralPopulation, 1},
+		{Index{Code: "gbr_defra", Category: "Moderate air pollution"}, Children, 1},
+		{Index{Code: "gbr_defra", Category: "Moderate air pollution"}, GeneralPopulation, 0},
+		{Index{Code: "eu_caqi", Category: "Very high air pollution"}, GeneralPopulation, 2},
+		{Index{Code: "ind_cpcb", Category: "Satisfactory air quality"}, LungDiseasePopulation, 1},
+		{Index{Code: "chn_mep", Category: "Light air pollution"}, Elderly, 1},
+		{Index{Code: "usa_epa", Category: "Unknown"}, LungDiseasePopulation, 0},
+		{Index{Code: "unknown", Category: "Good air quality"}, LungDiseasePopulation, 0},
+	}
+	for _, test := range tests {
+		if got := GroupSeverity(test.index, test.group); got != test.want {
+			t.Errorf("GroupSeverity(%s %q, %s) = %d, want %d", test.index.Code, test.index.Category, test.group, got, test.want)
+		}
+	}
+}
+
+func TestRankFollowsCategory(t *testing.T) {
+	recommendations := HealthRecommendations{
+		GeneralPopulation:     "general",
+		Athletes:              "athletes",
+		LungDiseasePopulation: "lung",
+		Children:              "children",
+	}
+	groups := []string{Athletes, LungDiseasePopulation, Children}
+	tests := []struct {
+		category string
+		order    []string
+	}{
+		// Nobody is affected yet, so the general advice leads
+		{"Good air quality", []string{GeneralPopulation, Athletes, LungDiseasePopulation, Children}},
+		{"Moderate air quality", []string{LungDiseasePopulation, GeneralPopulation, Athletes, Children}},
+		{"Unhealthy air quality for sensitive groups", []string{LungDiseasePopulation, Athletes, Children, GeneralPopulation}},
+		{"Very unhealthy air quality", []string{LungDiseasePopulation, Athletes, Children, GeneralPopulation}},
+	}
+	for _, test := range tests {
+		ranked := recommendations.Rank(Index{Code: "usa_epa", Category: test.category}, groups)
+		if len(ranked) != len(test.order) {
+			t.Fatalf("%s: got %d recommendations, want %d", test.category, len(ranked), len(test.order))
+		}
+		for i, group := range test.order {
+			if ranked[i].Group != group {
+				t.Errorf("%s: recommendation %d = %s, want %s", test.category, i, ranked[i].Group, group)
+			}
+		}
+	}
+	// Groups without advice are left out
+	if ranked := recommendations.Rank(Index{Code: "usa_epa"}, []string{Elderly}); len(ranked) != 1 {
+		t.Errorf("got %d recommendations, want only the general one", len(ranked))
+	}
+}
@@ -1,38 +1,41 @@
 package models
 
-import "time"
+import (
+	"github.com/Stutern-128/backend/units"
+	"time"
+)
 
 type AirQuality struct {
 	DateTime              time.Time             `json:"dateTime"`
 	RegionCode            string                `json:"regionCode"`
-	Indexes               []index               `json:"indexes"`
-	Pollutants            []pollutant           `json:"pollutants"`
-	HealthRecommendations healthRecommendations `json:"healthRecommendations"`
+	Indexes               []Index               `json:"indexes"`
+	Pollutants            []Pollutant           `json:"pollutants"`
+	HealthRecommendations HealthRecommendations `json:"healthRecommendations"`
 }
 
-type index struct {
+type Index struct {
 	Code              string `json:"code"`
 	DisplayName       string `json:"displayName"`
 	Aqi               int    `json:"aqi"`
 	AqiDisplay        string `json:"aqiDisplay"`
-	Color             color  `json:"color"`
+	Color             Color  `json:"color"`
 	Category          string `json:"category"`
 	DominantPollutant string `json:"dominantPollutant"`
 }
 
-type color struct {
+type Color struct {
 	Red   float64 `json:"red"`
 	Green float64 `json:"green"`
 	Blue  float64 `json:"blue"`
 	Alpha float64 `json:"alpha"`
 }
 
-type pollutant struct {
+type Pollutant struct {
 	Code           string         `json:"code"`
 	DisplayName    string         `json:"displayName"`
 	FullName       string         `json:"fullName"`
 	Concentration  Concentration  `json:"Concentration"`
-	AdditionalInfo additionalInfo `json:"additionalInfo"`
+	AdditionalInfo AdditionalInfo `json:"additionalInfo"`
 }
 
 type Concentration struct {
@@ -42,21 +45,26 @@ type Concentration struct {
 }
 
 func (c *Concentration) AddSymbol() *Concentration {
-	if c.Units == "PARTS_PER_BILLION" {
-		c.Symbol = "ppb"
-	}
-	if c.Units == "MICROGRAMS_PER_CUBIC_METER" {
-		c.Symbol = "μg/m³"
-	}
+	c.Symbol = units.Symbol(c.Units)
 	return c
 }
 
-type additionalInfo struct {
+// Convert returns the concentration of pollutant expressed in another unit.
+func (c Concentration) Convert(pollutant string, to string, conditions units.Conditions) (Concentration, error) {
+	value, err := units.Convert(pollutant, c.Value, c.Units, to, conditions)
+	if err != nil {
+		return c, err
+	}
+	converted := Concentration{Value: value, Units: to}
+	return *converted.AddSymbol(), nil
+}
+
+type AdditionalInfo struct {
 	Sources string `json:"sources"`
 	Effects string `json:"effects"`
 }
 
-type healthRecommendations struct {
+type HealthRecommendations struct {
 	GeneralPopulation      string `json:"generalPopulation"`
 	Elderly                string `json:"elderly"`
 	LungDiseasePopulation  string `json:"lungDiseasePopulation"`
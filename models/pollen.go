@@ -0,0 +1,94 @@
+package models
+
+import "fmt"
+
+// Pollen type codes of the Pollen API.
+const (
+	GrassPollen = "GRASS"
+	TreePollen  = "TREE"
+	WeedPollen  = "WEED"
+)
+
+type PollenForecast struct {
+	RegionCode    string      `json:"regionCode"`
+	DailyInfo     []PollenDay `json:"dailyInfo"`
+	NextPageToken string      `json:"nextPageToken"`
+}
+
+type PollenDay struct {
+	Date           Date             `json:"date"`
+	PollenTypeInfo []PollenTypeInfo `json:"pollenTypeInfo"`
+	PlantInfo      []PlantInfo      `json:"plantInfo"`
+}
+
+type Date struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+	Day   int `json:"day"`
+}
+
+// String formats the date as YYYY-MM-DD.
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+type PollenTypeInfo struct {
+	Code                  string       `json:"code"`
+	DisplayName           string       `json:"displayName"`
+	InSeason              bool         `json:"inSeason"`
+	IndexInfo             *PollenIndex `json:"indexInfo"`
+	HealthRecommendations []string     `json:"healthRecommendations"`
+}
+
+// PollenIndex is a Universal Pollen Index (UPI) value from 0 (none) to 5
+// (very high).
+type PollenIndex struct {
+	Code             string `json:"code"`
+	DisplayName      string `json:"displayName"`
+	Value            int    `json:"value"`
+	Category         string `json:"category"`
+	IndexDescription string `json:"indexDescription"`
+	Color            Color  `json:"color"`
+}
+
+type PlantInfo struct {
+	Code             string            `json:"code"`
+	DisplayName      string            `json:"displayName"`
+	InSeason         bool              `json:"inSeason"`
+	IndexInfo        *PollenIndex      `json:"indexInfo"`
+	PlantDescription *PlantDescription `json:"plantDescription"`
+}
+
+type PlantDescription struct {
+	Type          string `json:"type"`
+	Family        string `json:"family"`
+	Season        string `json:"season"`
+	SpecialColors string `json:"specialColors"`
+	SpecialShapes string `json:"specialShapes"`
+	CrossReaction string `json:"crossReaction"`
+	Picture       string `json:"picture"`
+}
+
+// Grass returns the grass pollen of the day, or nil if it is not reported.
+func (d PollenDay) Grass() *PollenTypeInfo {
+	return d.pollenType(GrassPollen)
+}
+
+// Tree returns the tree pollen of the day, or nil if it is not reported.
+func (d PollenDay) Tree() *PollenTypeInfo {
+	return d.pollenType(TreePollen)
+}
+
+// Weed returns the weed pollen of the day, or nil if it is not reported.
+func (d PollenDay) Weed() *PollenTypeInfo {
+	return d.pollenType(WeedPollen)
+}
+
+func (d PollenDay) pollenType(code string) *PollenTypeInfo {
+	for i := range d.PollenTypeInfo {
+		if d.PollenTypeInfo[i].Code == code {
+			return &d.PollenTypeInfo[i]
+		}
+	}
+	return nil
+}
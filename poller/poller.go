@@ -0,0 +1,139 @@
+package poller
+
+import (
+	"context"
+	"github.com/Stutern-128/backend/geo"
+	"github.com/Stutern-128/backend/metrics"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/Stutern-128/backend/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Poller regularly records the current conditions of tracked locations in the
+// history store, building up history past the provider's lookback window.
+type Poller struct {
+	provider  providers.AirQualityProvider
+	store     *store.Store
+	precision int
+	jitter    time.Duration
+	// slots limits how many upstream calls run at once
+	slots chan struct{}
+
+	mu      sync.Mutex
+	tracked map[string]context.CancelFunc
+	// running counts the polling goroutines, including stopped ones that
+	// haven't returned yet
+	running sync.WaitGroup
+}
+
+// New returns a poller writing readings for geohash cells of the given
+// precision. At most concurrency polls run at once and each poll is delayed
+// by a random amount up to jitter so locations added together spread out.
+func New(provider providers.AirQualityProvider, historyStore *store.Store, precision int, concurrency int, jitter time.Duration) *Poller {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &Poller{
+		provider:  provider,
+		store:     historyStore,
+		precision: precision,
+		jitter:    jitter,
+		slots:     make(chan struct{}, concurrency),
+		tracked:   make(map[string]context.CancelFunc),
+	}
+}
+
+// Track starts polling a location under key, replacing any location already
+// tracked under the same key.
+func (p *Poller) Track(key string, location store.TrackedLocation) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.mu.Lock()
+	if stop, ok := p.tracked[key]; ok {
+		stop()
+	}
+	p.tracked[key] = cancel
+	p.running.Add(1)
+	p.mu.Unlock()
+	go func() {
+		defer p.running.Done()
+		p.run(ctx, key, location)
+	}()
+}
+
+// Untrack stops polling the location tracked under key.
+func (p *Poller) Untrack(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if stop, ok := p.tracked[key]; ok {
+		stop()
+		delete(p.tracked, key)
+		metrics.LocationAQI.DeletePartialMatch(prometheus.Labels{"key": key})
+	}
+}
+
+// Stop stops polling every location and waits for polls in flight, so the
+// store can be closed afterwards.
+func (p *Poller) Stop() {
+	p.mu.Lock()
+	for key, stop := range p.tracked {
+		stop()
+		delete(p.tracked, key)
+		metrics.LocationAQI.DeletePartialMatch(prometheus.Labels{"key": key})
+	}
+	p.mu.Unlock()
+	p.running.Wait()
+}
+
+func (p *Poller) run(ctx context.Context, key string, location store.TrackedLocation) {
+	interval := time.Duration(location.IntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	delay := p.randomJitter()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		p.poll(ctx, key, location)
+		delay = interval + p.randomJitter()
+	}
+}
+
+func (p *Poller) poll(ctx context.Context, key string, location store.TrackedLocation) {
+	select {
+	case p.slots <- struct{}{}:
+		defer func() { <-p.slots }()
+	case <-ctx.Done():
+		return
+	}
+	airQuality, err := p.provider.CurrentConditions(ctx, providers.Request{
+		Latitude:          location.Latitude,
+		Longitude:         location.Longitude,
+		ExtraComputations: store.ReadingComputations,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error polling tracked location", "key", key, "error", err)
+		return
+	}
+	for _, index := range airQuality.Indexes {
+		metrics.LocationAQI.WithLabelValues(key, location.Name, index.Code).Set(float64(index.Aqi))
+	}
+	cell := geo.Geohash(location.Latitude, location.Longitude, p.precision)
+	if err := p.store.SaveReadings(ctx, cell, []models.AirQuality{*airQuality}); err != nil {
+		slog.ErrorContext(ctx, "Error saving reading", "key", key, "cell", cell, "error", err)
+	}
+}
+
+func (p *Poller) randomJitter() time.Duration {
+	if p.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(p.jitter)))
+}
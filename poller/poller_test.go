@@ -0,0 +1,49 @@
+package poller
+
+import (
+	"context"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/providers"
+	"github.com/Stutern-128/backend/store"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowProvider holds each poll until it is cancelled, then takes a while to
+// return like an upstream call winding down.
+type slowProvider struct {
+	providers.AirQualityProvider
+	started  chan struct{}
+	returned atomic.Bool
+}
+
+func (p *slowProvider) CurrentConditions(ctx context.Context, request providers.Request) (*models.AirQuality, error) {
+	p.started <- struct{}{}
+	<-ctx.Done()
+	time.Sleep(50 * time.Millisecond)
+	p.returned.Store(true)
+	return nil, ctx.Err()
+}
+
+func TestStopWaitsForPolls(t *testing.T) {
+	historyStore, err := store.Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer historyStore.Close()
+	provider := &slowProvider{started: make(chan struct{}, 1)}
+	p := New(provider, historyStore, 6, 1, 0)
+	p.Track("home", store.TrackedLocation{Name: "home", Latitude: 37.42, Longitude: -122.08, IntervalMinutes: 60})
+
+	select {
+	case <-provider.started:
+	case <-time.After(time.Second):
+		t.Fatal("location wasn't polled")
+	}
+	p.Stop()
+	if !provider.returned.Load() {
+		t.Error("Stop returned while a poll was in flight")
+	}
+}
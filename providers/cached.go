@@ -0,0 +1,70 @@
+package providers
+
+import (
+	"context"
+	"github.com/Stutern-128/backend/cache"
+	"github.com/Stutern-128/backend/coalesce"
+	"github.com/Stutern-128/backend/geo"
+	"github.com/Stutern-128/backend/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+// upstreamTimeout bounds a coalesced upstream call, which no longer follows
+// the context of any single caller.
+const upstreamTimeout = 30 * time.Second
+
+// Cached wraps a provider and serves repeat current condition lookups from
+// memory. Requests are keyed on their geohash cell, the hour and the extra
+// computations, so nearby clients in the same hour share one upstream call.
+// Concurrent misses for the same key are merged into a single upstream call.
+type Cached struct {
+	AirQualityProvider
+	precision int
+	cache     *cache.Cache[*models.AirQuality]
+	calls     coalesce.Group[*models.AirQuality]
+}
+
+// NewCached returns a caching provider snapping coordinates to geohash cells of
+// the given precision.
+func NewCached(provider AirQualityProvider, precision int, ttl time.Duration, maxEntries int) *Cached {
+	return &Cached{
+		AirQualityProvider: provider,
+		precision:          precision,
+		cache:              cache.New[*models.AirQuality](ttl, maxEntries),
+		calls:              coalesce.Group[*models.AirQuality]{Timeout: upstreamTimeout},
+	}
+}
+
+func (c *Cached) CurrentConditions(ctx context.Context, request Request) (*models.AirQuality, error) {
+	key := cellKey(request, c.precision)
+	if airQuality, ok := c.cache.Get(key); ok {
+		return airQuality, nil
+	}
+	return c.calls.Do(ctx, key, func(ctx context.Context) (*models.AirQuality, error) {
+		airQuality, err := c.AirQualityProvider.CurrentConditions(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		c.cache.Set(key, airQuality)
+		return airQuality, nil
+	})
+}
+
+// Stats returns the hit and miss counts of the current conditions cache.
+func (c *Cached) Stats() cache.Stats {
+	return c.cache.Stats()
+}
+
+// cellKey identifies a current conditions request by grid cell, hour and the
+// sorted extra computations.
+func cellKey(request Request, precision int) string {
+	computations := append([]string(nil), request.ExtraComputations...)
+	sort.Strings(computations)
+	return strings.Join([]string{
+		geo.Geohash(request.Latitude, request.Longitude, precision),
+		time.Now().UTC().Truncate(time.Hour).Format(time.RFC3339),
+		strings.Join(computations, ","),
+	}, "|")
+}
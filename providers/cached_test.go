@@ -0,0 +1,51 @@
+package providers
+
+import (
+	"context"
+	"github.com/Stutern-128/backend/models"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingProvider returns a fresh reading per call and counts the calls.
+type countingProvider struct {
+	AirQualityProvider
+	calls atomic.Int32
+}
+
+func (p *countingProvider) CurrentConditions(ctx context.Context, request Request) (*models.AirQuality, error) {
+	p.calls.Add(1)
+	return &models.AirQuality{DateTime: time.Now()}, nil
+}
+
+func TestCachedSharesGeohashCells(t *testing.T) {
+	upstream := &countingProvider{}
+	cached := NewCached(upstream, 6, time.Hour, 100)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		request Request
+		calls   int32
+	}{
+		{"first lookup", Request{Latitude: 37.4197, Longitude: -122.0827}, 1},
+		{"same cell, a few meters away", Request{Latitude: 37.4199, Longitude: -122.0829}, 1},
+		{"neighbouring cell", Request{Latitude: 37.4300, Longitude: -122.0827}, 2},
+		{"other computations", Request{Latitude: 37.4197, Longitude: -122.0827,
+			ExtraComputations: []string{"LOCAL_AQI", "HEALTH_RECOMMENDATIONS"}}, 3},
+		{"same computations in another order", Request{Latitude: 37.4197, Longitude: -122.0827,
+			ExtraComputations: []string{"HEALTH_RECOMMENDATIONS", "LOCAL_AQI"}}, 3},
+	}
+	for _, test := range tests {
+		if _, err := cached.CurrentConditions(ctx, test.request); err != nil {
+			t.Fatal(err)
+		}
+		if calls := upstream.calls.Load(); calls != test.calls {
+			t.Errorf("%s: %d upstream calls, want %d", test.name, calls, test.calls)
+		}
+	}
+	if stats := cached.Stats(); stats.Hits != 2 || stats.Misses != 3 {
+		t.Errorf("Stats() = %+v, want 2 hits and 3 misses", stats)
+	}
+}
@@ -0,0 +1,105 @@
+package providers
+
+import (
+	"github.com/Stutern-128/backend/aqi"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/units"
+	"sort"
+	"time"
+)
+
+type pollutantInfo struct {
+	DisplayName string
+	FullName    string
+	Units       string
+}
+
+// openAQPollutants are the OpenAQ parameters that feed the AQI, keyed by the
+// pollutant code the Air Quality API uses for the same pollutant.
+var openAQPollutants = map[string]pollutantInfo{
+	"pm25": {"PM2.5", "Fine particulate matter (<2.5µm)", units.MicrogramsPerCubicMeter},
+	"pm10": {"PM10", "Inhalable particulate matter (<10µm)", units.MicrogramsPerCubicMeter},
+	"o3":   {"O3", "Ozone", units.PartsPerBillion},
+	"no2":  {"NO2", "Nitrogen dioxide", units.PartsPerBillion},
+	"so2":  {"SO2", "Sulfur dioxide", units.PartsPerBillion},
+	"co":   {"CO", "Carbon monoxide", units.PartsPerBillion},
+}
+
+// normalize converts an OpenAQ measurement into the units the Air Quality API
+// reports for that pollutant: µg/m³ for particulates and ppb for gases.
+func normalize(code string, value float64, unit string) (float64, bool) {
+	info, ok := openAQPollutants[code]
+	if !ok || value < 0 {
+		return 0, false
+	}
+	from, ok := units.Parse(unit)
+	if !ok {
+		return 0, false
+	}
+	value, err := units.Convert(code, value, from, info.Units, units.Conditions{})
+	return value, err == nil
+}
+
+// buildAirQuality shapes raw concentrations like an Air Quality API reading.
+// Every index the aqi package knows is computed, US EPA first, and the
+// dominant pollutant is listed first. averaged optionally replaces
+// concentrations for the index computation, e.g. with PM NowCast values.
+func buildAirQuality(dateTime time.Time, concentrations map[string]float64, averaged map[string]float64, extraComputations []string) *models.AirQuality {
+	var pollutants []models.Pollutant
+	indexConcentrations := make(map[string]models.Concentration, len(concentrations))
+	for code, value := range concentrations {
+		info := openAQPollutants[code]
+		concentration := models.Concentration{Value: value, Units: info.Units}
+		pollutants = append(pollutants, models.Pollutant{
+			Code:          code,
+			DisplayName:   info.DisplayName,
+			FullName:      info.FullName,
+			Concentration: concentration,
+		})
+		if average, ok := averaged[code]; ok {
+			concentration.Value = average
+		}
+		indexConcentrations[code] = concentration
+	}
+
+	codes := []string{aqi.USEPA}
+	for _, code := range aqi.Codes() {
+		if code != aqi.USEPA {
+			codes = append(codes, code)
+		}
+	}
+	airQuality := &models.AirQuality{DateTime: dateTime}
+	for _, code := range codes {
+		result, err := aqi.Compute(code, indexConcentrations)
+		if err == nil {
+			airQuality.Indexes = append(airQuality.Indexes, result.Index())
+		}
+	}
+
+	dominant := ""
+	if len(airQuality.Indexes) > 0 {
+		dominant = airQuality.Indexes[0].DominantPollutant
+	}
+	sort.Slice(pollutants, func(i, j int) bool {
+		if pollutants[i].Code == dominant || pollutants[j].Code == dominant {
+			return pollutants[i].Code == dominant
+		}
+		return pollutants[i].Code < pollutants[j].Code
+	})
+	switch {
+	case contains(extraComputations, "POLLUTANT_CONCENTRATION"):
+		airQuality.Pollutants = pollutants
+	case contains(extraComputations, "DOMINANT_POLLUTANT_CONCENTRATION") && len(pollutants) > 0:
+		airQuality.Pollutants = pollutants[:1]
+	}
+	return airQuality
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
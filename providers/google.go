@@ -0,0 +1,143 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Stutern-128/backend/metering"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/tracing"
+	"github.com/gofiber/fiber/v2"
+	"strings"
+	"time"
+)
+
+// pageSize is the number of hours requested per history or forecast page.
+const pageSize = 72
+
+// Google reads air quality data from the Google Air Quality API.
+type Google struct {
+	BaseURL string
+	APIKey  string
+	// Meter, when set, records every call and can refuse it
+	Meter *metering.Meter
+}
+
+// NewGoogle returns a provider for the Air Quality API rooted at baseURL.
+func NewGoogle(baseURL string, apiKey string) *Google {
+	return &Google{BaseURL: baseURL, APIKey: apiKey}
+}
+
+var supportedCountryCodes = []string{
+	"al", "as", "ad", "ar", "am", "au", "at", "az", "bs", "bh", "bd", "by", "be", "ba", "br", "bn", "bg", "ca", "cl", "cn", "co",
+	"cr", "hr", "cy", "cz", "dk", "ec", "eg", "ee", "et", "fi", "fr", "ge", "de", "gi", "gr", "gu", "gg", "hk", "hu", "in", "id",
+	"ie", "il", "it", "jp", "je", "jo", "ke", "kr", "kw", "lv", "li", "lt", "lu", "my", "mt", "mu", "mx", "md", "mn", "me", "ma",
+	"np", "nl", "nz", "mk", "no", "pk", "pe", "ph", "pl", "pt", "pr", "qa", "re", "ro", "ru", "sa", "rs", "sg", "sk", "si", "za",
+	"es", "lk", "se", "ch", "tw", "th", "tr", "ug", "ua", "ae", "gb", "us",
+}
+
+func (g *Google) Supports(countryCode string) bool {
+	for _, code := range supportedCountryCodes {
+		if code == strings.ToLower(countryCode) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Google) CurrentConditions(ctx context.Context, request Request) (*models.AirQuality, error) {
+	var airQuality models.AirQuality
+	err := g.post(ctx, "currentConditions:lookup", fiber.Map{
+		"location":          location(request),
+		"extraComputations": request.ExtraComputations,
+	}, &airQuality)
+	if err != nil {
+		return nil, err
+	}
+	return &airQuality, nil
+}
+
+func (g *Google) History(ctx context.Context, request Request) (*models.AirQualities, error) {
+	payload := fiber.Map{
+		"location":          location(request),
+		"extraComputations": request.ExtraComputations,
+	}
+	if request.Start.IsZero() {
+		payload["hours"] = request.Hours
+	} else {
+		payload["period"] = period(request)
+	}
+	return g.paginate(ctx, "history:lookup", payload)
+}
+
+func (g *Google) Forecast(ctx context.Context, request Request) (*models.AirQualities, error) {
+	if request.Start.IsZero() {
+		// Forecasts start at the next full hour.
+		request.Start = time.Now().UTC().Truncate(time.Hour).Add(time.Hour)
+		request.End = request.Start.Add(time.Duration(request.Hours-1) * time.Hour)
+	}
+	return g.paginate(ctx, "forecast:lookup", fiber.Map{
+		"location":          location(request),
+		"extraComputations": request.ExtraComputations,
+		"period":            period(request),
+	})
+}
+
+// paginate calls a paged lookup method until nextPageToken runs out and
+// returns all hours in a single result.
+func (g *Google) paginate(ctx context.Context, method string, payload fiber.Map) (*models.AirQualities, error) {
+	var result models.AirQualities
+	payload["pageSize"] = pageSize
+	for {
+		var page models.AirQualities
+		if err := g.post(ctx, method, payload, &page); err != nil {
+			return nil, err
+		}
+		result.HoursInfo = append(result.HoursInfo, page.HoursInfo...)
+		result.RegionCode = page.RegionCode
+		if page.NextPageToken == "" {
+			return &result, nil
+		}
+		payload["pageToken"] = page.NextPageToken
+	}
+}
+
+func (g *Google) post(ctx context.Context, method string, payload fiber.Map, out interface{}) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := g.Meter.Record(ctx, metering.SKUAirQuality, method); err != nil {
+		return err
+	}
+	start := time.Now()
+	ctx, span := tracing.StartUpstream(ctx, "air_quality", method)
+	defer func() { finishUpstream(ctx, span, "air_quality", method, start, err) }()
+	url := fmt.Sprintf("%s%s?key=%s", g.BaseURL, method, g.APIKey)
+	agent := fiber.Post(url)
+	if deadline, ok := ctx.Deadline(); ok {
+		agent.Timeout(time.Until(deadline))
+	}
+	agent.JSON(payload)
+	statusCode, body, errs := agent.Bytes()
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	if statusCode != fiber.StatusOK {
+		return &UpstreamError{Method: method, StatusCode: statusCode, Body: string(body)}
+	}
+	return json.Unmarshal(body, out)
+}
+
+func location(request Request) fiber.Map {
+	return fiber.Map{
+		"latitude":  request.Latitude,
+		"longitude": request.Longitude,
+	}
+}
+
+func period(request Request) fiber.Map {
+	return fiber.Map{
+		"startTime": request.Start.UTC().Format(time.RFC3339),
+		"endTime":   request.End.UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,314 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Stutern-128/backend/aqi"
+	"github.com/Stutern-128/backend/metering"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/tracing"
+	"github.com/gofiber/fiber/v2"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nowCastHours is how many hours before each history hour feed its PM NowCast.
+const nowCastHours = 11
+
+// hoursPageSize is the page size of sensor hour lookups, the most OpenAQ
+// returns at once.
+const hoursPageSize = 1000
+
+// maxLatestAge is how old a station measurement may be before it no longer
+// counts as a current condition.
+const maxLatestAge = 3 * time.Hour
+
+// OpenAQ reads raw station measurements from an OpenAQ v3 compatible API and
+// shapes them like Air Quality API responses, computing the indexes itself
+// with US EPA as the headline index.
+type OpenAQ struct {
+	BaseURL string
+	APIKey  string
+	// Radius is the search radius around a location in meters (OpenAQ caps it at 25000).
+	Radius int
+	// Meter counts the calls made; nil counts nothing
+	Meter *metering.Meter
+}
+
+// NewOpenAQ returns a provider for the OpenAQ API rooted at baseURL.
+func NewOpenAQ(baseURL string, apiKey string, radius int) *OpenAQ {
+	if radius <= 0 || radius > 25000 {
+		radius = 25000
+	}
+	return &OpenAQ{BaseURL: baseURL, APIKey: apiKey, Radius: radius}
+}
+
+type openAQResults[T any] struct {
+	Results []T `json:"results"`
+}
+
+type openAQLocation struct {
+	ID       int            `json:"id"`
+	Name     string         `json:"name"`
+	Distance float64        `json:"distance"`
+	Country  openAQCountry  `json:"country"`
+	Sensors  []openAQSensor `json:"sensors"`
+}
+
+type openAQCountry struct {
+	Code string `json:"code"`
+}
+
+type openAQSensor struct {
+	ID        int             `json:"id"`
+	Parameter openAQParameter `json:"parameter"`
+}
+
+type openAQParameter struct {
+	Name  string `json:"name"`
+	Units string `json:"units"`
+}
+
+type openAQLatest struct {
+	Datetime  openAQDatetime `json:"datetime"`
+	Value     float64        `json:"value"`
+	SensorsID int            `json:"sensorsId"`
+}
+
+type openAQHour struct {
+	Value  float64      `json:"value"`
+	Period openAQPeriod `json:"period"`
+}
+
+type openAQPeriod struct {
+	DatetimeFrom openAQDatetime `json:"datetimeFrom"`
+}
+
+type openAQDatetime struct {
+	UTC time.Time `json:"utc"`
+}
+
+// Supports always reports true: coverage depends on nearby stations, which
+// CurrentConditions checks for itself.
+func (o *OpenAQ) Supports(countryCode string) bool {
+	return true
+}
+
+func (o *OpenAQ) CurrentConditions(ctx context.Context, request Request) (*models.AirQuality, error) {
+	locations, err := o.nearby(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	concentrations := make(map[string]float64)
+	var latestTime time.Time
+	for _, location := range locations {
+		var latest openAQResults[openAQLatest]
+		if err := o.get(ctx, "locations/latest", fmt.Sprintf("locations/%d/latest", location.ID), nil, &latest); err != nil {
+			return nil, err
+		}
+		for _, measurement := range latest.Results {
+			sensor, ok := location.sensor(measurement.SensorsID)
+			if !ok || time.Since(measurement.Datetime.UTC) > maxLatestAge {
+				continue
+			}
+			code := sensor.Parameter.Name
+			if _, seen := concentrations[code]; seen {
+				continue
+			}
+			value, ok := normalize(code, measurement.Value, sensor.Parameter.Units)
+			if !ok {
+				continue
+			}
+			concentrations[code] = value
+			if measurement.Datetime.UTC.After(latestTime) {
+				latestTime = measurement.Datetime.UTC
+			}
+		}
+		if len(concentrations) == len(openAQPollutants) {
+			break
+		}
+	}
+	if len(concentrations) == 0 {
+		return nil, fmt.Errorf("no recent OpenAQ measurements within %dm", o.Radius)
+	}
+	airQuality := buildAirQuality(latestTime.Truncate(time.Hour), concentrations, nil, request.ExtraComputations)
+	airQuality.RegionCode = regionCode(locations)
+	return airQuality, nil
+}
+
+func (o *OpenAQ) History(ctx context.Context, request Request) (*models.AirQualities, error) {
+	start, end := request.Start, request.End
+	if start.IsZero() {
+		end = time.Now().UTC().Truncate(time.Hour)
+		start = end.Add(-time.Duration(request.Hours) * time.Hour)
+	}
+	locations, err := o.nearby(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the nearest station that reports each pollutant.
+	sensors := make(map[string]openAQSensor)
+	for _, location := range locations {
+		for _, sensor := range location.Sensors {
+			code := sensor.Parameter.Name
+			if _, ok := openAQPollutants[code]; !ok {
+				continue
+			}
+			if _, seen := sensors[code]; !seen {
+				sensors[code] = sensor
+			}
+		}
+	}
+
+	hours := make(map[time.Time]map[string]float64)
+	for code, sensor := range sensors {
+		// Look back further so the first hours get a full PM NowCast
+		measurements, err := o.sensorHours(ctx, sensor.ID, start.Add(-nowCastHours*time.Hour), end)
+		if err != nil {
+			return nil, err
+		}
+		for _, measurement := range measurements {
+			value, ok := normalize(code, measurement.Value, sensor.Parameter.Units)
+			if !ok {
+				continue
+			}
+			hour := measurement.Period.DatetimeFrom.UTC.Truncate(time.Hour)
+			if hours[hour] == nil {
+				hours[hour] = make(map[string]float64)
+			}
+			hours[hour][code] = value
+		}
+	}
+
+	result := &models.AirQualities{RegionCode: regionCode(locations)}
+	for hour, concentrations := range hours {
+		if hour.Before(start) {
+			continue
+		}
+		averaged := make(map[string]float64)
+		for _, code := range []string{"pm25", "pm10"} {
+			series := make([]float64, nowCastHours+1)
+			for i := range series {
+				value, ok := hours[hour.Add(-time.Duration(i)*time.Hour)][code]
+				if !ok {
+					value = math.NaN()
+				}
+				series[i] = value
+			}
+			if nowCast, ok := aqi.NowCast(series); ok {
+				averaged[code] = nowCast
+			}
+		}
+		airQuality := buildAirQuality(hour, concentrations, averaged, request.ExtraComputations)
+		airQuality.RegionCode = result.RegionCode
+		result.HoursInfo = append(result.HoursInfo, *airQuality)
+	}
+	sort.Slice(result.HoursInfo, func(i, j int) bool {
+		return result.HoursInfo[i].DateTime.Before(result.HoursInfo[j].DateTime)
+	})
+	return result, nil
+}
+
+// Forecast is not available: OpenAQ only publishes observations.
+func (o *OpenAQ) Forecast(ctx context.Context, request Request) (*models.AirQualities, error) {
+	return nil, ErrUnsupported
+}
+
+// sensorHours returns the hourly measurements of a sensor between from and
+// to, paging through results until the range is covered.
+func (o *OpenAQ) sensorHours(ctx context.Context, sensorID int, from time.Time, to time.Time) ([]openAQHour, error) {
+	// A sensor reports at most one value an hour, which bounds the pages
+	// even if the API ignores the page parameter
+	maxPages := int(to.Sub(from).Hours())/hoursPageSize + 1
+	var hours []openAQHour
+	for page := 1; page <= maxPages; page++ {
+		var measurements openAQResults[openAQHour]
+		query := url.Values{
+			"datetime_from": {from.Format(time.RFC3339)},
+			"datetime_to":   {to.Format(time.RFC3339)},
+			"limit":         {strconv.Itoa(hoursPageSize)},
+			"page":          {strconv.Itoa(page)},
+		}
+		if err := o.get(ctx, "sensors/hours", fmt.Sprintf("sensors/%d/hours", sensorID), query, &measurements); err != nil {
+			return nil, err
+		}
+		hours = append(hours, measurements.Results...)
+		if len(measurements.Results) < hoursPageSize {
+			break
+		}
+	}
+	return hours, nil
+}
+
+// nearby returns the monitoring stations around a location, nearest first.
+func (o *OpenAQ) nearby(ctx context.Context, request Request) ([]openAQLocation, error) {
+	var locations openAQResults[openAQLocation]
+	query := url.Values{
+		"coordinates": {fmt.Sprintf("%f,%f", request.Latitude, request.Longitude)},
+		"radius":      {strconv.Itoa(o.Radius)},
+		"limit":       {"10"},
+	}
+	if err := o.get(ctx, "locations", "locations", query, &locations); err != nil {
+		return nil, err
+	}
+	if len(locations.Results) == 0 {
+		return nil, fmt.Errorf("no OpenAQ stations within %dm", o.Radius)
+	}
+	sort.SliceStable(locations.Results, func(i, j int) bool {
+		return locations.Results[i].Distance < locations.Results[j].Distance
+	})
+	return locations.Results, nil
+}
+
+// get calls path, which method names without the IDs in it for the metrics,
+// the trace and the log.
+func (o *OpenAQ) get(ctx context.Context, method string, path string, query url.Values, out interface{}) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := o.Meter.Record(ctx, metering.SKUOpenAQ, method); err != nil {
+		return err
+	}
+	start := time.Now()
+	ctx, span := tracing.StartUpstream(ctx, "openaq", method)
+	defer func() { finishUpstream(ctx, span, "openaq", method, start, err) }()
+	endpoint := o.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	agent := fiber.Get(endpoint)
+	agent.Set("X-API-Key", o.APIKey)
+	if deadline, ok := ctx.Deadline(); ok {
+		agent.Timeout(time.Until(deadline))
+	}
+	statusCode, body, errs := agent.Bytes()
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	if statusCode != fiber.StatusOK {
+		return &UpstreamError{Method: method, StatusCode: statusCode, Body: string(body)}
+	}
+	return json.Unmarshal(body, out)
+}
+
+func (l openAQLocation) sensor(id int) (openAQSensor, bool) {
+	for _, sensor := range l.Sensors {
+		if sensor.ID == id {
+			return sensor, true
+		}
+	}
+	return openAQSensor{}, false
+}
+
+func regionCode(locations []openAQLocation) string {
+	if len(locations) == 0 {
+		return ""
+	}
+	return strings.ToLower(locations[0].Country.Code)
+}
@@ -0,0 +1,103 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Stutern-128/backend/metering"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/tracing"
+	"github.com/gofiber/fiber/v2"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPollenDays is the longest forecast the Pollen API serves.
+const maxPollenDays = 5
+
+// PollenProvider is a source of daily pollen forecasts.
+type PollenProvider interface {
+	// Forecast returns the pollen forecast for a location, starting today.
+	Forecast(ctx context.Context, request PollenRequest) (*models.PollenForecast, error)
+	// Supports reports whether the provider has data for an ISO 3166 country code.
+	Supports(countryCode string) bool
+}
+
+// PollenRequest describes a pollen forecast lookup for a single location.
+type PollenRequest struct {
+	Latitude  float64
+	Longitude float64
+	// Days is the number of days to forecast, from 1 to 5.
+	Days int
+	// PlantsDescription asks for a description of each plant.
+	PlantsDescription bool
+}
+
+// GooglePollen reads pollen forecasts from the Google Pollen API.
+type GooglePollen struct {
+	BaseURL string
+	APIKey  string
+	// Countries lists the country codes with pollen coverage; empty means
+	// every country is tried.
+	Countries []string
+	// Meter, when set, records every call and can refuse it
+	Meter *metering.Meter
+}
+
+// NewGooglePollen returns a provider for the Pollen API rooted at baseURL.
+func NewGooglePollen(baseURL string, apiKey string, countries []string) *GooglePollen {
+	return &GooglePollen{BaseURL: baseURL, APIKey: apiKey, Countries: countries}
+}
+
+func (g *GooglePollen) Supports(countryCode string) bool {
+	if len(g.Countries) == 0 {
+		return true
+	}
+	for _, code := range g.Countries {
+		if strings.EqualFold(code, countryCode) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *GooglePollen) Forecast(ctx context.Context, request PollenRequest) (_ *models.PollenForecast, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := g.Meter.Record(ctx, metering.SKUPollen, "forecast:lookup"); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	ctx, span := tracing.StartUpstream(ctx, "pollen", "forecast:lookup")
+	defer func() { finishUpstream(ctx, span, "pollen", "forecast:lookup", start, err) }()
+	days := request.Days
+	if days <= 0 || days > maxPollenDays {
+		days = maxPollenDays
+	}
+	query := url.Values{
+		"key":                {g.APIKey},
+		"location.latitude":  {strconv.FormatFloat(request.Latitude, 'f', -1, 64)},
+		"location.longitude": {strconv.FormatFloat(request.Longitude, 'f', -1, 64)},
+		"days":               {strconv.Itoa(days)},
+		"plantsDescription":  {strconv.FormatBool(request.PlantsDescription)},
+	}
+	agent := fiber.Get(fmt.Sprintf("%sforecast:lookup?%s", g.BaseURL, query.Encode()))
+	if deadline, ok := ctx.Deadline(); ok {
+		agent.Timeout(time.Until(deadline))
+	}
+	statusCode, body, errs := agent.Bytes()
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	if statusCode != fiber.StatusOK {
+		return nil, &UpstreamError{Method: "forecast:lookup", StatusCode: statusCode, Body: string(body)}
+	}
+	var forecast models.PollenForecast
+	if err := json.Unmarshal(body, &forecast); err != nil {
+		return nil, err
+	}
+	return &forecast, nil
+}
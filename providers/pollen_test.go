@@ -0,0 +1,135 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"github.com/Stutern-128/backend/models"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newPollenStandIn serves testdata/pollen/forecast.json for forecast:lookup
+// calls, or the recorded error of locations without coverage when unsupported
+// is set.
+func newPollenStandIn(t *testing.T, unsupported bool) *GooglePollen {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/forecast:lookup" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query := r.URL.Query()
+		if query.Get("key") != "test-key" || query.Get("location.latitude") != "37.4197" ||
+			query.Get("location.longitude") != "-122.0827" || query.Get("plantsDescription") != "true" {
+			t.Errorf("forecast query = %s", r.URL.RawQuery)
+		}
+		name, status := "forecast.json", http.StatusOK
+		if unsupported {
+			name, status = "unsupported.json", http.StatusBadRequest
+		}
+		body, err := os.ReadFile(filepath.Join("testdata", "pollen", name))
+		if err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return NewGooglePollen(server.URL+"/v1/", "test-key", []string{"US", "FR"})
+}
+
+var pollenRequest = PollenRequest{Latitude: 37.4197, Longitude: -122.0827, Days: 2, PlantsDescription: true}
+
+func TestGooglePollenForecast(t *testing.T) {
+	provider := newPollenStandIn(t, false)
+
+	forecast, err := provider.Forecast(context.Background(), pollenRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forecast.RegionCode != "US" || len(forecast.DailyInfo) != 2 {
+		t.Fatalf("forecast = %s with %d days, want US with 2", forecast.RegionCode, len(forecast.DailyInfo))
+	}
+
+	tests := []struct {
+		day      int
+		code     string
+		value    int
+		category string
+		inSeason bool
+		missing  bool
+	}{
+		{day: 0, code: "GRASS", value: 2, category: "Low", inSeason: true},
+		{day: 0, code: "TREE", value: 4, category: "High", inSeason: true},
+		{day: 0, code: "WEED", value: 0, category: "None"},
+		{day: 1, code: "GRASS", value: 3, category: "Moderate", inSeason: true},
+		{day: 1, code: "TREE", value: 5, category: "Very High", inSeason: true},
+		{day: 1, code: "WEED", missing: true},
+	}
+	for _, test := range tests {
+		day := forecast.DailyInfo[test.day]
+		pollen := map[string]func() *models.PollenTypeInfo{
+			"GRASS": day.Grass,
+			"TREE":  day.Tree,
+			"WEED":  day.Weed,
+		}[test.code]()
+		if test.missing {
+			if pollen != nil {
+				t.Errorf("%s %s = %+v, want nil", day.Date, test.code, pollen)
+			}
+			continue
+		}
+		if pollen == nil || pollen.IndexInfo == nil {
+			t.Errorf("%s %s has no index", day.Date, test.code)
+			continue
+		}
+		if pollen.IndexInfo.Value != test.value || pollen.IndexInfo.Category != test.category || pollen.InSeason != test.inSeason {
+			t.Errorf("%s %s = %d %q in season %v, want %d %q in season %v", day.Date, test.code,
+				pollen.IndexInfo.Value, pollen.IndexInfo.Category, pollen.InSeason, test.value, test.category, test.inSeason)
+		}
+	}
+
+	today := forecast.DailyInfo[0]
+	if today.Date.String() != "2024-04-22" {
+		t.Errorf("date = %s, want 2024-04-22", today.Date)
+	}
+	if len(today.PlantInfo) != 3 {
+		t.Fatalf("got %d plants, want 3", len(today.PlantInfo))
+	}
+	oak := today.PlantInfo[0]
+	if oak.Code != "OAK" || oak.IndexInfo == nil || oak.IndexInfo.Value != 4 ||
+		oak.PlantDescription == nil || oak.PlantDescription.Family != "Fagaceae" {
+		t.Errorf("oak = %+v", oak)
+	}
+	// Plants out of season come without an index
+	if ragweed := today.PlantInfo[2]; ragweed.IndexInfo != nil || ragweed.InSeason {
+		t.Errorf("ragweed = %+v, want no index out of season", ragweed)
+	}
+}
+
+func TestGooglePollenUnsupportedLocation(t *testing.T) {
+	provider := newPollenStandIn(t, true)
+
+	_, err := provider.Forecast(context.Background(), pollenRequest)
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) || upstreamErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("err = %v, want a 400 UpstreamError", err)
+	}
+}
+
+func TestGooglePollenSupports(t *testing.T) {
+	provider := NewGooglePollen("", "", []string{"US", "FR"})
+	for code, want := range map[string]bool{"US": true, "us": true, "FR": true, "CN": false, "": false} {
+		if got := provider.Supports(code); got != want {
+			t.Errorf("Supports(%q) = %v, want %v", code, got, want)
+		}
+	}
+	if !NewGooglePollen("", "", nil).Supports("CN") {
+		t.Error("Supports without a country list = false, want true")
+	}
+}
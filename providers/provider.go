@@ -0,0 +1,68 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Stutern-128/backend/logging"
+	"github.com/Stutern-128/backend/metrics"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/tracing"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// AirQualityProvider is a source of air quality data. Handlers only talk to
+// this interface so the upstream service can be swapped without touching them.
+type AirQualityProvider interface {
+	// CurrentConditions returns the latest hourly reading for a location.
+	CurrentConditions(ctx context.Context, request Request) (*models.AirQuality, error)
+	// History returns past hourly readings, oldest pages first.
+	History(ctx context.Context, request Request) (*models.AirQualities, error)
+	// Forecast returns hourly readings ahead of the current hour.
+	Forecast(ctx context.Context, request Request) (*models.AirQualities, error)
+	// Supports reports whether the provider has data for an ISO 3166 country code.
+	Supports(countryCode string) bool
+}
+
+// ErrUnsupported is returned by providers that cannot serve a lookup method.
+var ErrUnsupported = errors.New("lookup not supported by this provider")
+
+// Request describes a lookup for a single location.
+type Request struct {
+	Latitude          float64
+	Longitude         float64
+	ExtraComputations []string
+	// Hours is the number of hours to look back (History) or ahead (Forecast).
+	Hours int
+	// Start and End optionally bound History and Forecast lookups instead of Hours.
+	Start time.Time
+	End   time.Time
+}
+
+// UpstreamError is returned when the upstream service answers with a non-OK status.
+type UpstreamError struct {
+	Method     string
+	StatusCode int
+	Body       string
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%s returned status %d: %s", e.Method, e.StatusCode, e.Body)
+}
+
+// finishUpstream records a call to method of an upstream api that started at
+// start and returned err in the metrics, the trace and the log.
+func finishUpstream(ctx context.Context, span trace.Span, api string, method string, start time.Time, err error) {
+	status := fiber.StatusOK
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) {
+		status = upstreamErr.StatusCode
+	} else if err != nil {
+		status = 0
+	}
+	metrics.ObserveUpstream(api, method, start, err)
+	tracing.End(span, err)
+	logging.Upstream(ctx, api, method, status, start, err)
+}
@@ -0,0 +1,61 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"github.com/Stutern-128/backend/metering"
+	"github.com/Stutern-128/backend/tracing"
+	"github.com/gofiber/fiber/v2"
+	"time"
+)
+
+// MaxTileZoom is the deepest zoom level heatmap tiles are served at.
+const MaxTileZoom = 16
+
+// HeatmapTypes are the map types of the Air Quality API heatmap tiles.
+var HeatmapTypes = []string{
+	"UAQI_RED_GREEN",
+	"UAQI_INDIGO_PERSIAN",
+	"PM25_INDIGO_PERSIAN",
+	"GBR_DEFRA",
+	"DEU_UBA",
+	"CAN_EC",
+	"FRA_ATMO",
+	"US_AQI",
+}
+
+// IsHeatmapType reports whether mapType is one of HeatmapTypes.
+func IsHeatmapType(mapType string) bool {
+	return contains(HeatmapTypes, mapType)
+}
+
+// TileProvider serves heatmap tiles for map overlays.
+type TileProvider interface {
+	// HeatmapTile returns the PNG tile at zoom z and tile coordinates x and y.
+	HeatmapTile(ctx context.Context, mapType string, z int, x int, y int) ([]byte, error)
+}
+
+func (g *Google) HeatmapTile(ctx context.Context, mapType string, z int, x int, y int) (_ []byte, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := g.Meter.Record(ctx, metering.SKUHeatmapTile, "heatmapTiles"); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	ctx, span := tracing.StartUpstream(ctx, "air_quality", "heatmapTiles")
+	defer func() { finishUpstream(ctx, span, "air_quality", "heatmapTiles", start, err) }()
+	method := fmt.Sprintf("mapTypes/%s/heatmapTiles/%d/%d/%d", mapType, z, x, y)
+	agent := fiber.Get(fmt.Sprintf("%s%s?key=%s", g.BaseURL, method, g.APIKey))
+	if deadline, ok := ctx.Deadline(); ok {
+		agent.Timeout(time.Until(deadline))
+	}
+	statusCode, body, errs := agent.Bytes()
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	if statusCode != fiber.StatusOK {
+		return nil, &UpstreamError{Method: "heatmapTiles", StatusCode: statusCode, Body: string(body)}
+	}
+	return body, nil
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// APIKey is a client API key. Only a hash of the key is stored; the prefix
+// is kept to tell keys apart in listings.
+type APIKey struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+	Hash   string `json:"-"`
+	Admin  bool   `json:"admin"`
+	// RatePerMinute and DailyQuota limit the requests made with the key; zero means no limit
+	RatePerMinute int        `json:"ratePerMinute"`
+	DailyQuota    int        `json:"dailyQuota"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	RevokedAt     *time.Time `json:"revokedAt,omitempty"`
+}
+
+const apiKeyColumns = `id, name, prefix, key_hash, admin, rate_per_minute, daily_quota, created_at, revoked_at`
+
+func (s *Store) APIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// APIKeyByHash returns the key with the given hash, or nil if there is none.
+// Revoked keys are returned too.
+func (s *Store) APIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ?`, hash)
+	key, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return key, err
+}
+
+// AddAPIKey stores a key and sets its ID and creation time.
+func (s *Store) AddAPIKey(ctx context.Context, key *APIKey) error {
+	key.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO api_keys (name, prefix, key_hash, admin, rate_per_minute, daily_quota, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		key.Name, key.Prefix, key.Hash, key.Admin, key.RatePerMinute, key.DailyQuota, key.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	key.ID, err = result.LastInsertId()
+	return err
+}
+
+// RevokeAPIKey marks a key as revoked and reports whether an active key with
+// the ID existed.
+func (s *Store) RevokeAPIKey(ctx context.Context, id int64) (bool, error) {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now().UTC().Unix(), id)
+	if err != nil {
+		return false, err
+	}
+	revoked, err := result.RowsAffected()
+	return revoked > 0, err
+}
+
+func scanAPIKey(row scanner) (*APIKey, error) {
+	var key APIKey
+	var createdAt int64
+	var revokedAt sql.NullInt64
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Hash, &key.Admin, &key.RatePerMinute, &key.DailyQuota,
+		&createdAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.CreatedAt = time.Unix(createdAt, 0).UTC()
+	if revokedAt.Valid {
+		revoked := time.Unix(revokedAt.Int64, 0).UTC()
+		key.RevokedAt = &revoked
+	}
+	return &key, nil
+}
@@ -0,0 +1,99 @@
+package store
+
+// migrations are applied in order; a migration's version is its index plus
+// one. Never edit a released migration, append a new one instead.
+var migrations = []string{
+	`CREATE TABLE readings (
+		cell TEXT NOT NULL,
+		hour INTEGER NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (cell, hour)
+	);
+	CREATE INDEX readings_hour ON readings (hour);`,
+	`CREATE TABLE tracked_locations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		latitude REAL NOT NULL,
+		longitude REAL NOT NULL,
+		interval_minutes INTEGER NOT NULL
+	);`,
+	`CREATE TABLE subscriptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		latitude REAL NOT NULL,
+		longitude REAL NOT NULL,
+		threshold INTEGER NOT NULL DEFAULT 0,
+		category TEXT NOT NULL DEFAULT '',
+		webhook_url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		last_category TEXT NOT NULL DEFAULT '',
+		breached INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL
+	);`,
+	`CREATE TABLE health_profiles (
+		user_id TEXT PRIMARY KEY,
+		population_groups TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	);`,
+	`CREATE TABLE saved_locations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		latitude REAL NOT NULL,
+		longitude REAL NOT NULL,
+		time_zone TEXT NOT NULL DEFAULT '',
+		preferred_index TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX saved_locations_user ON saved_locations (user_id);`,
+	`CREATE TABLE api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		admin INTEGER NOT NULL DEFAULT 0,
+		rate_per_minute INTEGER NOT NULL DEFAULT 0,
+		daily_quota INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL,
+		revoked_at INTEGER
+	);`,
+	`CREATE TABLE upstream_usage (
+		month TEXT NOT NULL,
+		sku TEXT NOT NULL,
+		client TEXT NOT NULL,
+		endpoint TEXT NOT NULL,
+		calls INTEGER NOT NULL,
+		PRIMARY KEY (month, sku, client, endpoint)
+	);`,
+	`ALTER TABLE subscriptions ADD COLUMN user_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX subscriptions_user ON subscriptions (user_id);`,
+}
+
+// migrate brings the schema up to date, recording applied versions in
+// schema_migrations.
+func (s *Store) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+	var version int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// HealthProfile lists the population groups a user belongs to, so they are
+// only shown the health recommendations that apply to them.
+type HealthProfile struct {
+	UserID    string    `json:"userId"`
+	Groups    []string  `json:"groups"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// HealthProfile returns the profile of a user, or nil if there is none.
+func (s *Store) HealthProfile(ctx context.Context, userID string) (*HealthProfile, error) {
+	var groups string
+	var updatedAt int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT population_groups, updated_at FROM health_profiles WHERE user_id = ?`, userID).Scan(&groups, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	profile := &HealthProfile{UserID: userID, Groups: []string{}, UpdatedAt: time.Unix(updatedAt, 0).UTC()}
+	if groups != "" {
+		profile.Groups = strings.Split(groups, ",")
+	}
+	return profile, nil
+}
+
+// SaveHealthProfile creates or replaces a profile and sets its update time.
+func (s *Store) SaveHealthProfile(ctx context.Context, profile *HealthProfile) error {
+	profile.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO health_profiles (user_id, population_groups, updated_at) VALUES (?, ?, ?)`,
+		profile.UserID, strings.Join(profile.Groups, ","), profile.UpdatedAt.Unix())
+	return err
+}
+
+// RemoveHealthProfile deletes a profile and reports whether it existed.
+func (s *Store) RemoveHealthProfile(ctx context.Context, userID string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM health_profiles WHERE user_id = ?`, userID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
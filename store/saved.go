@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// MaxSavedLocations caps the locations a user can save.
+const MaxSavedLocations = 50
+
+var ErrTooManySavedLocations = errors.New("too many saved locations")
+
+// SavedLocation is a place a user keeps coming back to, with the settings
+// the client would otherwise resend on every call.
+type SavedLocation struct {
+	ID             int64     `json:"id"`
+	UserID         string    `json:"-"`
+	Name           string    `json:"name"`
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	TimeZone       string    `json:"timeZone"`
+	PreferredIndex string    `json:"preferredIndex"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+const savedLocationColumns = `id, user_id, name, latitude, longitude, time_zone, preferred_index, created_at`
+
+func (s *Store) SavedLocations(ctx context.Context, userID string) ([]SavedLocation, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+savedLocationColumns+` FROM saved_locations WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var locations []SavedLocation
+	for rows.Next() {
+		location, err := scanSavedLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, *location)
+	}
+	return locations, rows.Err()
+}
+
+// SavedLocation returns a location of the user, or nil if there is none.
+func (s *Store) SavedLocation(ctx context.Context, userID string, id int64) (*SavedLocation, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+savedLocationColumns+` FROM saved_locations WHERE id = ? AND user_id = ?`, id, userID)
+	location, err := scanSavedLocation(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return location, err
+}
+
+// AddSavedLocation stores a location and sets its ID and creation time. It
+// returns ErrTooManySavedLocations when the user already has
+// MaxSavedLocations.
+func (s *Store) AddSavedLocation(ctx context.Context, location *SavedLocation) error {
+	location.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO saved_locations (user_id, name, latitude, longitude, time_zone, preferred_index, created_at)
+		SELECT ?, ?, ?, ?, ?, ?, ?
+		WHERE (SELECT COUNT(*) FROM saved_locations WHERE user_id = ?) < ?`,
+		location.UserID, location.Name, location.Latitude, location.Longitude, location.TimeZone,
+		location.PreferredIndex, location.CreatedAt.Unix(), location.UserID, MaxSavedLocations)
+	if err != nil {
+		return err
+	}
+	if added, err := result.RowsAffected(); err != nil {
+		return err
+	} else if added == 0 {
+		return ErrTooManySavedLocations
+	}
+	location.ID, err = result.LastInsertId()
+	return err
+}
+
+// UpdateSavedLocation replaces a location of the user and reports whether it
+// exists.
+func (s *Store) UpdateSavedLocation(ctx context.Context, location *SavedLocation) (bool, error) {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE saved_locations SET name = ?, latitude = ?, longitude = ?, time_zone = ?, preferred_index = ?
+		WHERE id = ? AND user_id = ?`,
+		location.Name, location.Latitude, location.Longitude, location.TimeZone, location.PreferredIndex,
+		location.ID, location.UserID)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+// RemoveSavedLocation deletes a location of the user and reports whether it
+// existed.
+func (s *Store) RemoveSavedLocation(ctx context.Context, userID string, id int64) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM saved_locations WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+func scanSavedLocation(row scanner) (*SavedLocation, error) {
+	var location SavedLocation
+	var createdAt int64
+	err := row.Scan(&location.ID, &location.UserID, &location.Name, &location.Latitude, &location.Longitude,
+		&location.TimeZone, &location.PreferredIndex, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	location.CreatedAt = time.Unix(createdAt, 0).UTC()
+	return &location, nil
+}
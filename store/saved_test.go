@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddSavedLocationCap(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	add := func(userID string) error {
+		return s.AddSavedLocation(ctx, &SavedLocation{UserID: userID, Name: "home", Latitude: 37.42, Longitude: -122.08})
+	}
+
+	for i := 0; i < MaxSavedLocations; i++ {
+		if err := add("key:1"); err != nil {
+			t.Fatalf("location %d: %v", i, err)
+		}
+	}
+	if err := add("key:1"); !errors.Is(err, ErrTooManySavedLocations) {
+		t.Errorf("location past the cap: err = %v, want ErrTooManySavedLocations", err)
+	}
+	if err := add("key:2"); err != nil {
+		t.Errorf("another user's location: %v", err)
+	}
+	locations, err := s.SavedLocations(ctx, "key:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != MaxSavedLocations {
+		t.Errorf("got %d locations, want %d", len(locations), MaxSavedLocations)
+	}
+
+	// Removing one makes room again
+	if _, err := s.RemoveSavedLocation(ctx, "key:1", locations[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := add("key:1"); err != nil {
+		t.Errorf("location after a removal: %v", err)
+	}
+}
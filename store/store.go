@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/Stutern-128/backend/models"
+	"log/slog"
+	_ "modernc.org/sqlite"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ReadingComputations are the extra computations every stored reading is
+// fetched with, so readings from different writers can be mixed in one chart.
+var ReadingComputations = []string{"LOCAL_AQI", "POLLUTANT_CONCENTRATION"}
+
+// Store is the local SQLite database holding hourly readings per geohash cell.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it if needed, and applies any
+// pending schema migrations.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path))
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Readings returns the stored readings of a cell for hours in [from, to),
+// oldest first.
+func (s *Store) Readings(ctx context.Context, cell string, from time.Time, to time.Time) ([]models.AirQuality, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT data FROM readings WHERE cell = ? AND hour >= ? AND hour < ? ORDER BY hour`,
+		cell, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var readings []models.AirQuality
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var reading models.AirQuality
+		if err := json.Unmarshal(data, &reading); err != nil {
+			return nil, err
+		}
+		readings = append(readings, reading)
+	}
+	return readings, rows.Err()
+}
+
+// SaveReadings stores readings for a cell, replacing any already stored for
+// the same hours.
+func (s *Store) SaveReadings(ctx context.Context, cell string, readings []models.AirQuality) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, reading := range readings {
+		data, err := json.Marshal(reading)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO readings (cell, hour, data) VALUES (?, ?, ?)`,
+			cell, reading.DateTime.Truncate(time.Hour).Unix(), data)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Prune deletes readings older than before and returns how many were removed.
+func (s *Store) Prune(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM readings WHERE hour < ?`, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// EnforceRetention prunes readings older than retention once an hour. It
+// blocks, so run it in its own goroutine.
+func (s *Store) EnforceRetention(retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		removed, err := s.Prune(context.Background(), time.Now().Add(-retention))
+		if err != nil {
+			slog.Error("Error pruning history", "error", err)
+		} else if removed > 0 {
+			slog.Info("Pruned history", "readings", removed, "retention", retention)
+		}
+		<-ticker.C
+	}
+}
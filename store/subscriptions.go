@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Subscription asks for a webhook call when the AQI at a location crosses a
+// threshold value or category. Without either, every category change is sent.
+type Subscription struct {
+	ID        int64   `json:"id"`
+	UserID    string  `json:"-"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Threshold int     `json:"threshold,omitempty"`
+	Category  string  `json:"category,omitempty"`
+	// WebhookURL receives the HMAC signed alert payloads
+	WebhookURL string `json:"webhookUrl"`
+	// Secret signs the payloads; it is only shown when the subscription is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// LastCategory and Breached hold the state of the previous evaluation
+	LastCategory string `json:"lastCategory,omitempty"`
+	Breached     bool   `json:"breached"`
+}
+
+const subscriptionColumns = `id, user_id, latitude, longitude, threshold, category, webhook_url, secret, last_category, breached, created_at`
+
+// Subscriptions returns the subscriptions of every user.
+func (s *Store) Subscriptions(ctx context.Context) ([]Subscription, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanSubscriptions(rows)
+}
+
+func (s *Store) UserSubscriptions(ctx context.Context, userID string) ([]Subscription, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+subscriptionColumns+` FROM subscriptions WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanSubscriptions(rows)
+}
+
+func scanSubscriptions(rows *sql.Rows) ([]Subscription, error) {
+	defer rows.Close()
+	var subscriptions []Subscription
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, *subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+// Subscription returns a subscription of the user, or nil if there is none.
+func (s *Store) Subscription(ctx context.Context, userID string, id int64) (*Subscription, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = ? AND user_id = ?`, id, userID)
+	subscription, err := scanSubscription(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return subscription, err
+}
+
+// AddSubscription stores a subscription and sets its ID and creation time.
+func (s *Store) AddSubscription(ctx context.Context, subscription *Subscription) error {
+	subscription.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO subscriptions (user_id, latitude, longitude, threshold, category, webhook_url, secret, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		subscription.UserID, subscription.Latitude, subscription.Longitude, subscription.Threshold, subscription.Category,
+		subscription.WebhookURL, subscription.Secret, subscription.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	subscription.ID, err = result.LastInsertId()
+	return err
+}
+
+// UpdateSubscription replaces the location, threshold and webhook of a
+// subscription of its user and resets its evaluation state. It reports
+// whether the subscription exists.
+func (s *Store) UpdateSubscription(ctx context.Context, subscription *Subscription) (bool, error) {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE subscriptions SET latitude = ?, longitude = ?, threshold = ?, category = ?, webhook_url = ?,
+		last_category = '', breached = 0 WHERE id = ? AND user_id = ?`,
+		subscription.Latitude, subscription.Longitude, subscription.Threshold, subscription.Category,
+		subscription.WebhookURL, subscription.ID, subscription.UserID)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+// SetSubscriptionState records the outcome of the latest evaluation.
+func (s *Store) SetSubscriptionState(ctx context.Context, id int64, lastCategory string, breached bool) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE subscriptions SET last_category = ?, breached = ? WHERE id = ?`,
+		lastCategory, breached, id)
+	return err
+}
+
+// RemoveSubscription deletes a subscription of the user and reports whether
+// it existed.
+func (s *Store) RemoveSubscription(ctx context.Context, userID string, id int64) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM subscriptions WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSubscription(row scanner) (*Subscription, error) {
+	var subscription Subscription
+	var createdAt int64
+	err := row.Scan(&subscription.ID, &subscription.UserID, &subscription.Latitude, &subscription.Longitude, &subscription.Threshold,
+		&subscription.Category, &subscription.WebhookURL, &subscription.Secret, &subscription.LastCategory,
+		&subscription.Breached, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	subscription.CreatedAt = time.Unix(createdAt, 0).UTC()
+	return &subscription, nil
+}
@@ -0,0 +1,52 @@
+package store
+
+import "context"
+
+// TrackedLocation is a location the poller records current conditions for.
+type TrackedLocation struct {
+	ID              int64   `json:"id"`
+	Name            string  `json:"name"`
+	Latitude        float64 `json:"latitude"`
+	Longitude       float64 `json:"longitude"`
+	IntervalMinutes int     `json:"intervalMinutes"`
+}
+
+func (s *Store) TrackedLocations(ctx context.Context) ([]TrackedLocation, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, name, latitude, longitude, interval_minutes FROM tracked_locations ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var locations []TrackedLocation
+	for rows.Next() {
+		var location TrackedLocation
+		if err := rows.Scan(&location.ID, &location.Name, &location.Latitude, &location.Longitude, &location.IntervalMinutes); err != nil {
+			return nil, err
+		}
+		locations = append(locations, location)
+	}
+	return locations, rows.Err()
+}
+
+// AddTrackedLocation stores a location and sets its ID.
+func (s *Store) AddTrackedLocation(ctx context.Context, location *TrackedLocation) error {
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO tracked_locations (name, latitude, longitude, interval_minutes) VALUES (?, ?, ?, ?)`,
+		location.Name, location.Latitude, location.Longitude, location.IntervalMinutes)
+	if err != nil {
+		return err
+	}
+	location.ID, err = result.LastInsertId()
+	return err
+}
+
+// RemoveTrackedLocation deletes a location and reports whether it existed.
+func (s *Store) RemoveTrackedLocation(ctx context.Context, id int64) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM tracked_locations WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+)
+
+// UpstreamUsage is the number of calls made to one endpoint of a billed
+// upstream SKU on behalf of one client during a calendar month.
+type UpstreamUsage struct {
+	// Month is the UTC month as YYYY-MM
+	Month    string `json:"month"`
+	SKU      string `json:"sku"`
+	Client   string `json:"client"`
+	Endpoint string `json:"endpoint"`
+	Calls    int64  `json:"calls"`
+}
+
+// UpstreamUsage returns the usage recorded for a month.
+func (s *Store) UpstreamUsage(ctx context.Context, month string) ([]UpstreamUsage, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT month, sku, client, endpoint, calls FROM upstream_usage WHERE month = ?`, month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var usage []UpstreamUsage
+	for rows.Next() {
+		var u UpstreamUsage
+		if err := rows.Scan(&u.Month, &u.SKU, &u.Client, &u.Endpoint, &u.Calls); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// AddUpstreamUsage adds call counts to the usage already recorded.
+func (s *Store) AddUpstreamUsage(ctx context.Context, usage []UpstreamUsage) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, u := range usage {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO upstream_usage (month, sku, client, endpoint, calls) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (month, sku, client, endpoint) DO UPDATE SET calls = calls + excluded.calls`,
+			u.Month, u.SKU, u.Client, u.Endpoint, u.Calls)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,126 @@
+package stream
+
+import (
+	"context"
+	"github.com/Stutern-128/backend/geo"
+	"github.com/Stutern-128/backend/models"
+	"github.com/Stutern-128/backend/providers"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Hub fans current conditions out to stream subscribers. All subscribers in
+// the same geohash cell share a single upstream poll, which stops when the
+// last of them leaves.
+type Hub struct {
+	provider  providers.AirQualityProvider
+	precision int
+	interval  time.Duration
+
+	mu    sync.Mutex
+	cells map[string]*cell
+}
+
+type cell struct {
+	subscribers map[chan *models.AirQuality]struct{}
+	latest      *models.AirQuality
+	cancel      context.CancelFunc
+}
+
+// NewHub returns a hub polling each watched cell every interval.
+func NewHub(provider providers.AirQualityProvider, precision int, interval time.Duration) *Hub {
+	return &Hub{
+		provider:  provider,
+		precision: precision,
+		interval:  interval,
+		cells:     make(map[string]*cell),
+	}
+}
+
+// Subscribe returns a channel receiving the reading for a location each time
+// it changes, starting with the latest known one. Call unsubscribe once the
+// subscriber goes away.
+func (h *Hub) Subscribe(latitude float64, longitude float64) (updates <-chan *models.AirQuality, unsubscribe func()) {
+	key := geo.Geohash(latitude, longitude, h.precision)
+	ch := make(chan *models.AirQuality, 1)
+
+	h.mu.Lock()
+	c, ok := h.cells[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		c = &cell{subscribers: make(map[chan *models.AirQuality]struct{}), cancel: cancel}
+		h.cells[key] = c
+		go h.poll(ctx, key, c, latitude, longitude)
+	}
+	c.subscribers[ch] = struct{}{}
+	if c.latest != nil {
+		ch <- c.latest
+	}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(c.subscribers, ch)
+		if len(c.subscribers) == 0 && h.cells[key] == c {
+			c.cancel()
+			delete(h.cells, key)
+		}
+	}
+}
+
+func (h *Hub) poll(ctx context.Context, key string, c *cell, latitude float64, longitude float64) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		airQuality, err := h.provider.CurrentConditions(ctx, providers.Request{
+			Latitude:          latitude,
+			Longitude:         longitude,
+			ExtraComputations: []string{"LOCAL_AQI", "POLLUTANT_CONCENTRATION"},
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.ErrorContext(ctx, "Error polling stream cell", "cell", key, "error", err)
+		} else {
+			h.publish(c, airQuality)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish hands a reading to every subscriber if it differs from the last
+// one. Slow subscribers only ever see the newest reading.
+func (h *Hub) publish(c *cell, airQuality *models.AirQuality) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c.latest != nil && !changed(c.latest, airQuality) {
+		return
+	}
+	c.latest = airQuality
+	for ch := range c.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- airQuality
+	}
+}
+
+func changed(previous *models.AirQuality, current *models.AirQuality) bool {
+	if !previous.DateTime.Equal(current.DateTime) || len(previous.Indexes) != len(current.Indexes) {
+		return true
+	}
+	for i := range current.Indexes {
+		if previous.Indexes[i].Aqi != current.Indexes[i].Aqi {
+			return true
+		}
+	}
+	return false
+}
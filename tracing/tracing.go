@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/url"
+	"os"
+)
+
+// Tracer starts the spans of the backend. Until Setup installs an exporter
+// its spans are not recorded.
+var Tracer = otel.Tracer("github.com/Stutern-128/backend")
+
+// Setup installs the global tracer provider and W3C trace context
+// propagation. exporter is "otlp", sending over HTTP to otlpEndpoint (such as
+// http://localhost:4318/v1/traces) or to the OTEL_EXPORTER_OTLP_* environment
+// defaults when empty, "stdout", or "" to leave tracing off. sampleRatio is
+// the share of new traces recorded. The returned function flushes and stops
+// the exporter.
+func Setup(exporter string, otlpEndpoint string, serviceName string, version string, sampleRatio float64) (func(context.Context) error, error) {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		var options []otlptracehttp.Option
+		if otlpEndpoint != "" {
+			endpoint, err := url.Parse(otlpEndpoint)
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, otlptracehttp.WithEndpoint(endpoint.Host))
+			if endpoint.Scheme == "http" {
+				options = append(options, otlptracehttp.WithInsecure())
+			}
+			if endpoint.Path != "" && endpoint.Path != "/" {
+				options = append(options, otlptracehttp.WithURLPath(endpoint.Path))
+			}
+		}
+		spanExporter, err = otlptracehttp.New(context.Background(), options...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// StartUpstream starts a client span for a call to method of an upstream api.
+func StartUpstream(ctx context.Context, api string, method string) (context.Context, trace.Span) {
+	return Tracer.Start(ctx, api+" "+method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("upstream.api", api), attribute.String("upstream.method", method)))
+}
+
+// End ends a span, marking it failed if err is set.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,94 @@
+package track
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type geoJSONObject struct {
+	Type       string          `json:"type"`
+	Features   []geoJSONObject `json:"features"`
+	Geometry   *geoJSONObject  `json:"geometry"`
+	Properties struct {
+		Name string `json:"name"`
+		// CoordTimes holds a timestamp per coordinate, nested per line for
+		// MultiLineStrings, as written by most GPX to GeoJSON converters
+		CoordTimes json.RawMessage `json:"coordTimes"`
+	} `json:"properties"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// parseGeoJSON reads the LineString and MultiLineString features of a
+// FeatureCollection or Feature. Timestamps come from the coordTimes property,
+// or from a fourth coordinate holding Unix seconds.
+func parseGeoJSON(data []byte) (*Track, error) {
+	var root geoJSONObject
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	features := []geoJSONObject{root}
+	if root.Type == "FeatureCollection" {
+		features = root.Features
+	}
+	var parsed Track
+	for _, feature := range features {
+		if feature.Type != "Feature" || feature.Geometry == nil {
+			continue
+		}
+		if parsed.Name == "" {
+			parsed.Name = feature.Properties.Name
+		}
+		var lines [][][]float64
+		var times [][]string
+		switch feature.Geometry.Type {
+		case "LineString":
+			var line [][]float64
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &line); err != nil {
+				return nil, err
+			}
+			lines = [][][]float64{line}
+			if len(feature.Properties.CoordTimes) > 0 {
+				var lineTimes []string
+				if err := json.Unmarshal(feature.Properties.CoordTimes, &lineTimes); err != nil {
+					return nil, err
+				}
+				times = [][]string{lineTimes}
+			}
+		case "MultiLineString":
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &lines); err != nil {
+				return nil, err
+			}
+			if len(feature.Properties.CoordTimes) > 0 {
+				if err := json.Unmarshal(feature.Properties.CoordTimes, &times); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			continue
+		}
+		for i, line := range lines {
+			segment := make([]Point, 0, len(line))
+			for j, coordinate := range line {
+				if len(coordinate) < 2 {
+					return nil, errors.New("coordinate needs a longitude and a latitude")
+				}
+				point := Point{Latitude: coordinate[1], Longitude: coordinate[0]}
+				switch {
+				case i < len(times) && j < len(times[i]):
+					t, err := time.Parse(time.RFC3339, times[i][j])
+					if err != nil {
+						return nil, fmt.Errorf("invalid coordTimes entry: %w", err)
+					}
+					point.Time = t
+				case len(coordinate) >= 4:
+					point.Time = time.Unix(int64(coordinate[3]), 0).UTC()
+				}
+				segment = append(segment, point)
+			}
+			parsed.Segments = append(parsed.Segments, segment)
+		}
+	}
+	return &parsed, nil
+}
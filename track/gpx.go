@@ -0,0 +1,55 @@
+package track
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+type gpxFile struct {
+	Tracks []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name     string       `xml:"name"`
+	Segments []gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Latitude  float64 `xml:"lat,attr"`
+	Longitude float64 `xml:"lon,attr"`
+	Time      string  `xml:"time"`
+}
+
+// parseGPX reads the track segments of every track in a GPX 1.1 file.
+func parseGPX(data []byte) (*Track, error) {
+	var file gpxFile
+	if err := xml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	var parsed Track
+	for _, trk := range file.Tracks {
+		if parsed.Name == "" {
+			parsed.Name = trk.Name
+		}
+		for _, trkseg := range trk.Segments {
+			segment := make([]Point, 0, len(trkseg.Points))
+			for _, trkpt := range trkseg.Points {
+				point := Point{Latitude: trkpt.Latitude, Longitude: trkpt.Longitude}
+				if trkpt.Time != "" {
+					t, err := time.Parse(time.RFC3339, trkpt.Time)
+					if err != nil {
+						return nil, err
+					}
+					point.Time = t
+				}
+				segment = append(segment, point)
+			}
+			parsed.Segments = append(parsed.Segments, segment)
+		}
+	}
+	return &parsed, nil
+}
@@ -0,0 +1,82 @@
+package track
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+// Point is a timestamped position on a track.
+type Point struct {
+	Latitude  float64
+	Longitude float64
+	Time      time.Time
+}
+
+// Track is a recorded trip made of segments, such as the trkseg elements of a
+// GPX file or the lines of a GeoJSON MultiLineString.
+type Track struct {
+	Name     string
+	Segments [][]Point
+}
+
+// MaxPoints caps the size of a parsed track.
+const MaxPoints = 50000
+
+// clockSkew is how far ahead of the server clock a point may be, for devices
+// with a slightly fast clock.
+const clockSkew = time.Minute
+
+var (
+	ErrUnknownFormat = errors.New("track is neither GPX nor GeoJSON")
+	ErrNoTimestamps  = errors.New("track points need timestamps")
+	ErrEmpty         = errors.New("track has no points")
+	ErrTooLarge      = errors.New("track has too many points")
+	ErrFuture        = errors.New("track has points in the future")
+)
+
+// Parse reads a GPX or GeoJSON track, telling them apart by the first
+// character. Every point must carry a timestamp, and none may be in the
+// future.
+func Parse(data []byte) (*Track, error) {
+	data = bytes.TrimSpace(data)
+	var parsed *Track
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte("<")):
+		parsed, err = parseGPX(data)
+	case bytes.HasPrefix(data, []byte("{")):
+		parsed, err = parseGeoJSON(data)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	latest := time.Now().Add(clockSkew)
+	var points int
+	var segments [][]Point
+	for _, segment := range parsed.Segments {
+		if len(segment) == 0 {
+			continue
+		}
+		for _, point := range segment {
+			if point.Time.IsZero() {
+				return nil, ErrNoTimestamps
+			}
+			if point.Time.After(latest) {
+				return nil, ErrFuture
+			}
+		}
+		points += len(segment)
+		segments = append(segments, segment)
+	}
+	if points == 0 {
+		return nil, ErrEmpty
+	}
+	if points > MaxPoints {
+		return nil, ErrTooLarge
+	}
+	parsed.Segments = segments
+	return parsed, nil
+}
@@ -0,0 +1,111 @@
+package track
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		name     string
+		segments []int
+		err      error
+	}{
+		// The empty trkseg is dropped
+		{"ride.gpx", "Morning ride", []int{3, 2}, nil},
+		// coordTimes per line, then Unix seconds as a fourth coordinate
+		{"walk.geojson", "Evening walk", []int{2, 3, 2}, nil},
+		{"untimed.gpx", "", nil, ErrNoTimestamps},
+		{"future.gpx", "", nil, ErrFuture},
+		{"empty.geojson", "", nil, ErrEmpty},
+	}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			parsed, err := Parse(readFixture(t, test.fixture))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("err = %v, want %v", err, test.err)
+			}
+			if test.err != nil {
+				return
+			}
+			if parsed.Name != test.name {
+				t.Errorf("name = %q, want %q", parsed.Name, test.name)
+			}
+			var segments []int
+			for _, segment := range parsed.Segments {
+				segments = append(segments, len(segment))
+			}
+			if fmt.Sprint(segments) != fmt.Sprint(test.segments) {
+				t.Errorf("segment lengths = %v, want %v", segments, test.segments)
+			}
+		})
+	}
+}
+
+func TestParsePoints(t *testing.T) {
+	parsed, err := Parse(readFixture(t, "walk.geojson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Point{
+		{Latitude: 51.5072, Longitude: -0.1276, Time: time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)},
+		{Latitude: 51.5115, Longitude: -0.1190, Time: time.Unix(1714590060, 0).UTC()},
+	}
+	got := []Point{parsed.Segments[0][0], parsed.Segments[2][1]}
+	for i := range want {
+		if got[i].Latitude != want[i].Latitude || got[i].Longitude != want[i].Longitude || !got[i].Time.Equal(want[i].Time) {
+			t.Errorf("point %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"unclosed GPX element", readFixture(t, "malformed.gpx")},
+		{"truncated GeoJSON", []byte(`{"type": "Feature", "geometry": {"type": "LineString"`)},
+		{"GeoJSON coordinate without latitude", []byte(`{"type": "Feature", "geometry": {"type": "LineString", "coordinates": [[1]]}}`)},
+		{"bad GPX time", []byte(`<gpx><trk><trkseg><trkpt lat="1" lon="2"><time>yesterday</time></trkpt></trkseg></trk></gpx>`)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Parse(test.data); err == nil {
+				t.Error("err = nil, want a parse error")
+			}
+		})
+	}
+	if _, err := Parse([]byte("lat,lon\n1,2")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("err = %v, want %v", err, ErrUnknownFormat)
+	}
+}
+
+func TestParseTooLarge(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	var gpx strings.Builder
+	gpx.WriteString("<gpx><trk><trkseg>")
+	for i := 0; i <= MaxPoints; i++ {
+		fmt.Fprintf(&gpx, `<trkpt lat="37.77" lon="-122.41"><time>%s</time></trkpt>`,
+			start.Add(time.Duration(i)*time.Second).Format(time.RFC3339))
+	}
+	gpx.WriteString("</trkseg></trk></gpx>")
+	if _, err := Parse([]byte(gpx.String())); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("err = %v, want %v", err, ErrTooLarge)
+	}
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,134 @@
+package units
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Units as named by the Air Quality API. PARTS_PER_MILLION and
+// MILLIGRAMS_PER_CUBIC_METER are not returned by Google but follow its naming.
+const (
+	PartsPerBillion         = "PARTS_PER_BILLION"
+	PartsPerMillion         = "PARTS_PER_MILLION"
+	MicrogramsPerCubicMeter = "MICROGRAMS_PER_CUBIC_METER"
+	MilligramsPerCubicMeter = "MILLIGRAMS_PER_CUBIC_METER"
+)
+
+// gasConstant is R in L·hPa/(K·mol).
+const gasConstant = 83.1446
+
+// molecularWeights in g/mol of the gases that can be expressed as mixing ratios.
+var molecularWeights = map[string]float64{
+	"o3":   48.00,
+	"no2":  46.01,
+	"no":   30.01,
+	"so2":  64.07,
+	"co":   28.01,
+	"nh3":  17.03,
+	"c6h6": 78.11,
+}
+
+var symbols = map[string]string{
+	PartsPerBillion:         "ppb",
+	PartsPerMillion:         "ppm",
+	MicrogramsPerCubicMeter: "μg/m³",
+	MilligramsPerCubicMeter: "mg/m³",
+}
+
+// aliases maps the spellings callers use to the unit names above.
+var aliases = map[string]string{
+	"ppb":   PartsPerBillion,
+	"ppm":   PartsPerMillion,
+	"μg/m³": MicrogramsPerCubicMeter,
+	"µg/m³": MicrogramsPerCubicMeter,
+	"ug/m³": MicrogramsPerCubicMeter,
+	"ug/m3": MicrogramsPerCubicMeter,
+	"mg/m³": MilligramsPerCubicMeter,
+	"mg/m3": MilligramsPerCubicMeter,
+}
+
+// Conditions are the air temperature and pressure a mixing ratio is converted
+// at. Nil fields default to 25°C and 1013.25 hPa.
+type Conditions struct {
+	TemperatureCelsius  *float64
+	PressureHectopascal *float64
+}
+
+// MolarVolume returns the volume in liters of one mole of gas.
+func (c Conditions) MolarVolume() float64 {
+	temperature, pressure := 25.0, 1013.25
+	if c.TemperatureCelsius != nil {
+		temperature = *c.TemperatureCelsius
+	}
+	if c.PressureHectopascal != nil {
+		pressure = *c.PressureHectopascal
+	}
+	return gasConstant * (temperature + 273.15) / pressure
+}
+
+// Parse returns the unit name for a symbol such as "ppb" or "µg/m³", or for a
+// unit name itself.
+func Parse(unit string) (string, bool) {
+	if _, ok := symbols[unit]; ok {
+		return unit, true
+	}
+	name, ok := aliases[strings.ToLower(strings.TrimSpace(unit))]
+	return name, ok
+}
+
+// Symbol returns the short symbol of a unit name, or "" if it is unknown.
+func Symbol(unit string) string {
+	return symbols[unit]
+}
+
+// MolecularWeight returns the molecular weight of a gaseous pollutant.
+func MolecularWeight(pollutant string) (float64, bool) {
+	weight, ok := molecularWeights[strings.ToLower(pollutant)]
+	return weight, ok
+}
+
+// Convert expresses a pollutant concentration in another unit. Converting
+// between mixing ratios (ppb, ppm) and mass concentrations (µg/m³, mg/m³)
+// uses the pollutant's molecular weight and the molar volume at conditions,
+// so it only works for gases.
+func Convert(pollutant string, value float64, from string, to string, conditions Conditions) (float64, error) {
+	if _, ok := symbols[from]; !ok {
+		return 0, fmt.Errorf("unknown unit %q", from)
+	}
+	if _, ok := symbols[to]; !ok {
+		return 0, fmt.Errorf("unknown unit %q", to)
+	}
+	if from == to {
+		return value, nil
+	}
+	// Scale to ppb or µg/m³ first
+	switch from {
+	case PartsPerMillion:
+		value, from = value*1000, PartsPerBillion
+	case MilligramsPerCubicMeter:
+		value, from = value*1000, MicrogramsPerCubicMeter
+	}
+	target := to
+	switch to {
+	case PartsPerMillion:
+		target = PartsPerBillion
+	case MilligramsPerCubicMeter:
+		target = MicrogramsPerCubicMeter
+	}
+
+	if from != target {
+		weight, ok := MolecularWeight(pollutant)
+		if !ok {
+			return 0, fmt.Errorf("%s cannot be converted between mixing ratio and mass concentration", pollutant)
+		}
+		if from == PartsPerBillion {
+			value = value * weight / conditions.MolarVolume()
+		} else {
+			value = value * conditions.MolarVolume() / weight
+		}
+	}
+	if to != target {
+		value /= 1000
+	}
+	return value, nil
+}
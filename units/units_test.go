@@ -0,0 +1,86 @@
+package units
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConvertFactors(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+	standard := Conditions{}
+	// The 20°C reference conditions of the EU air quality directive
+	europe := Conditions{TemperatureCelsius: value(20)}
+	freezing := Conditions{TemperatureCelsius: value(0)}
+	altitude := Conditions{PressureHectopascal: value(850)}
+
+	tests := []struct {
+		name       string
+		pollutant  string
+		from, to   string
+		conditions Conditions
+		want       float64
+	}{
+		// Published factors for 1 ppb at 25°C and 1013.25 hPa
+		{"no2 at 25°C", "no2", PartsPerBillion, MicrogramsPerCubicMeter, standard, 1.88},
+		{"o3 at 25°C", "o3", PartsPerBillion, MicrogramsPerCubicMeter, standard, 1.96},
+		{"so2 at 25°C", "so2", PartsPerBillion, MicrogramsPerCubicMeter, standard, 2.62},
+		{"c6h6 at 25°C", "c6h6", PartsPerBillion, MicrogramsPerCubicMeter, standard, 3.19},
+		{"co at 25°C", "co", PartsPerMillion, MilligramsPerCubicMeter, standard, 1.145},
+		// Factors of the EU directive at 20°C
+		{"no2 at 20°C", "no2", PartsPerBillion, MicrogramsPerCubicMeter, europe, 1.91},
+		{"o3 at 20°C", "o3", PartsPerBillion, MicrogramsPerCubicMeter, europe, 2.00},
+		{"so2 at 20°C", "so2", PartsPerBillion, MicrogramsPerCubicMeter, europe, 2.66},
+		{"co at 20°C", "co", PartsPerMillion, MilligramsPerCubicMeter, europe, 1.16},
+		// Colder or lower pressure air holds the same mixing ratio in more or less mass
+		{"no2 at 0°C", "no2", PartsPerBillion, MicrogramsPerCubicMeter, freezing, 2.05},
+		{"o3 at 850 hPa", "o3", PartsPerBillion, MicrogramsPerCubicMeter, altitude, 1.65},
+		{"o3 back to ppb", "o3", MicrogramsPerCubicMeter, PartsPerBillion, standard, 1 / 1.962},
+		{"ppm to µg/m³", "no2", PartsPerMillion, MicrogramsPerCubicMeter, standard, 1881},
+		{"µg/m³ to mg/m³", "pm25", MicrogramsPerCubicMeter, MilligramsPerCubicMeter, standard, 0.001},
+		{"ppb to ppm", "pm25", PartsPerBillion, PartsPerMillion, standard, 0.001},
+		{"same unit", "pm25", MicrogramsPerCubicMeter, MicrogramsPerCubicMeter, standard, 1},
+	}
+	for _, test := range tests {
+		got, err := Convert(test.pollutant, 1, test.from, test.to, test.conditions)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		// Published factors are rounded to 3 significant digits
+		if math.Abs(got-test.want)/test.want > 0.005 {
+			t.Errorf("%s: 1 %s = %v %s, want %v", test.name, Symbol(test.from), got, Symbol(test.to), test.want)
+		}
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	if _, err := Convert("pm25", 1, MicrogramsPerCubicMeter, PartsPerBillion, Conditions{}); err == nil {
+		t.Error("converted particulate matter to a mixing ratio")
+	}
+	if _, err := Convert("no2", 1, "furlongs", PartsPerBillion, Conditions{}); err == nil {
+		t.Error("converted from an unknown unit")
+	}
+	if _, err := Convert("no2", 1, PartsPerBillion, "furlongs", Conditions{}); err == nil {
+		t.Error("converted to an unknown unit")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]string{
+		"ppb":                   PartsPerBillion,
+		"PPM":                   PartsPerMillion,
+		"μg/m³":                 MicrogramsPerCubicMeter,
+		"µg/m³":                 MicrogramsPerCubicMeter,
+		"ug/m³":                 MicrogramsPerCubicMeter,
+		" ug/m3 ":               MicrogramsPerCubicMeter,
+		"mg/m3":                 MilligramsPerCubicMeter,
+		MicrogramsPerCubicMeter: MicrogramsPerCubicMeter,
+		"furlongs":              "",
+	}
+	for unit, want := range tests {
+		got, ok := Parse(unit)
+		if got != want || ok != (want != "") {
+			t.Errorf("Parse(%q) = %q, %v, want %q", unit, got, ok, want)
+		}
+	}
+}